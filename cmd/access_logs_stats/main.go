@@ -6,11 +6,17 @@ import (
 	"log"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/blackbass1988/access_logs_stats/pkg"
 	_ "github.com/blackbass1988/access_logs_stats/pkg/output/console"
+	_ "github.com/blackbass1988/access_logs_stats/pkg/output/graphite"
+	_ "github.com/blackbass1988/access_logs_stats/pkg/output/influxdb"
+	_ "github.com/blackbass1988/access_logs_stats/pkg/output/prometheus"
+	_ "github.com/blackbass1988/access_logs_stats/pkg/output/statsd"
 	_ "github.com/blackbass1988/access_logs_stats/pkg/output/zabbix"
+	"github.com/blackbass1988/access_logs_stats/pkg/re"
 	prof "github.com/blackbass1988/yet_another_pprof_wrapper"
 )
 
@@ -43,6 +49,8 @@ func main() {
 		heapProfile      string
 		cpuProfile       string
 		exitAfterOneTick bool
+		regexpEngine     string
+		adminListen      string
 		showVersion      bool
 		templateVars     templateVarsArray
 		templateVarsMap  map[string]string
@@ -51,10 +59,13 @@ func main() {
 	printHello()
 
 	flag.BoolVar(&showVersion, "version", false, "show current version")
-	flag.StringVar(&fileconfig, "c", "", "config path")
+	flag.StringVar(&fileconfig, "c", "", "config path or conf.d directory with *.json and *.yaml configs")
 	flag.StringVar(&heapProfile, "heapprofile", "", "enable heap profiling")
 	flag.StringVar(&cpuProfile, "cpuprofile", "", "Write the cpu heapProfile to `filename`")
 	flag.BoolVar(&exitAfterOneTick, "one", false, "make one tick end exit")
+	flag.StringVar(&regexpEngine, "regexp-engine", "",
+		"default regexp engine: "+strings.Join(re.Engines(), " or ")+". Config's regexp_engine overrides it")
+	flag.StringVar(&adminListen, "admin-listen", "", "address of admin http listener with /metrics, /healthz and /readyz, e.g. :9102")
 	flag.Var(&templateVars,
 		"template-var",
 		`Extra variables to set into output template.
@@ -86,24 +97,46 @@ For example: -template-var key=value -template-var foo=bar`)
 		go prof.ProfileMemory(mWriter, 10*time.Second, true)
 	}
 
+	if regexpEngine != "" {
+		if err := re.SetDefaultEngine(regexpEngine); err != nil {
+			log.Fatal(err)
+		}
+	}
+
 	if fileconfig == "" {
 		log.Print("ERROR config not set")
 		flag.PrintDefaults()
 		os.Exit(2)
 	}
 
-	config, err := pkg.NewConfig(fileconfig, templateVarsMap)
+	configs, err := pkg.NewConfigs(fileconfig, templateVarsMap)
 	if err != nil {
 		log.Fatal(err)
 	}
-	config.ExitAfterOneTick = exitAfterOneTick
 
-	app, err := pkg.NewApp(config)
-	if err != nil {
-		log.Fatal(err)
+	if adminListen != "" {
+		if _, err := pkg.ListenAdmin(adminListen); err != nil {
+			log.Fatal(err)
+		}
 	}
 
-	app.Start()
+	//every config is an independent pipeline. It is only one if -c is a file
+	var wg sync.WaitGroup
+	for _, config := range configs {
+		config.ExitAfterOneTick = exitAfterOneTick
+
+		app, err := pkg.NewApp(config)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			app.Start()
+		}()
+	}
+	wg.Wait()
 }
 
 type templateVarsArray []string
@@ -0,0 +1,37 @@
+package pkg
+
+import (
+	"log"
+	"net"
+	"net/http"
+
+	"github.com/blackbass1988/access_logs_stats/pkg/metrics"
+)
+
+//newAdminHandler returns handler of admin http listener
+func newAdminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Default)
+	mux.Handle("/healthz", healthHandler(false))
+	mux.Handle("/readyz", healthHandler(true))
+	return mux
+}
+
+//ListenAdmin starts admin http listener in background. It serves internal metrics on /metrics
+//and liveness and readiness probes on /healthz and /readyz
+func ListenAdmin(addr string) (*http.Server, error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	server := &http.Server{Handler: newAdminHandler()}
+	go func() {
+		if err := server.Serve(l); err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+
+	log.Printf("admin listener started on %s\n", l.Addr())
+	return server, nil
+}
@@ -6,26 +6,44 @@ import (
 	"github.com/blackbass1988/access_logs_stats/pkg/template"
 	"log"
 	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/blackbass1988/access_logs_stats/pkg/input"
 	"github.com/blackbass1988/access_logs_stats/pkg/re"
 )
 
+//lineChannelSize is a count of read lines which can wait for parsing.
+//Its fullness is exposed as "line_channel_backlog" internal metric
+const lineChannelSize = 1024
+
 var (
-	errEmptyResult   = errors.New("bad string or regular expression")
-	errFiltersNotSet = errors.New("filters not set")
-	errOutputNotSet  = errors.New("there are least one output must be specified. 0 found")
+	errEmptyResult        = errors.New("bad string or regular expression")
+	errFiltersNotSet      = errors.New("filters not set")
+	errOutputNotSet       = errors.New("there are least one output must be specified. 0 found")
+	errRegexpAndLogFormat = errors.New("only one of regexp, nginx_log_format and apache_log_format can be set")
+	errRegexpAndParser    = errors.New("regexp and log formats are used only by regexp parser")
+	errInputState         = errors.New("input_state is supported only by file input")
 )
 
 //RowEntry contains raw input string and parsed fields of it
 type RowEntry struct {
 	Fields map[string]string
 	Raw    string
+
+	//Numbers contains values of fields which were parsed as numbers by parser, e.g. by json parser
+	Numbers map[string]float64
 }
 
 //App is a main struct of application
 type App struct {
+	//inputOpened and lastLine are unix nano times for /healthz. They are first for atomic alignment
+	inputOpened int64
+	lastLine    int64
+
 	fi     os.FileInfo
 	file   *os.File
 	config Config
@@ -34,6 +52,20 @@ type App struct {
 	senderCollection *SenderCollection
 	ir               input.BufferedReader
 
+	//inputDone is closed when all lines of current input are appended
+	inputDone chan struct{}
+
+	//lineChannel contains lines read from input but not appended yet
+	lineChannel chan input.Line
+
+	//sending counts periodic sendStats in progress
+	sending sync.WaitGroup
+	//sendM makes periodic sendings one by one, so positions of older period can't be saved after newer ones
+	sendM sync.Mutex
+
+	//m guards config and senderCollection replaced on reload
+	m sync.RWMutex
+
 	fileReader *bufio.Reader
 }
 
@@ -77,12 +109,14 @@ func NewRow(rawString string, rex re.RegExp) (row *RowEntry, err error) {
 	return row, err
 }
 
-//Start starts an app
+//Start starts an app. It returns after SIGINT, SIGTERM or end of input.
+//SIGHUP reloads config, new config is applied at the end of current period
 func (a *App) Start() {
 	var err error
-	a.init()
+	err = a.init()
+	checkOrFail(err)
+	registerApp(a)
 
-	tick := time.Tick(a.config.Period)
 	log.Println("start a reading...")
 	err = a.openReader()
 	checkOrFail(err)
@@ -91,61 +125,232 @@ func (a *App) Start() {
 		a.ir.Close()
 	}()
 
-	lineChannel := make(chan string)
-	go a.ir.ReadToChannel(lineChannel)
-
 	if a.config.ExitAfterOneTick {
-		a.appendLine(lineChannel)
-		a.senderCollection.sendStats()
-	} else {
-		go a.appendLine(lineChannel)
-		//read to buffer in background
-
-		for {
-			select {
-			case <-tick:
-				go a.senderCollection.sendStats()
+		<-a.inputDone
+		a.senderCollection.sendStats(time.Now(), a.config.Period)
+		a.senderCollection.close()
+		return
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	reloads := make(chan os.Signal, 1)
+	signal.Notify(reloads, syscall.SIGHUP)
+	defer signal.Stop(reloads)
+
+	var newConfig *Config
+
+	ticker := time.NewTicker(a.config.Period)
+	defer func() {
+		ticker.Stop()
+	}()
+	periodStart := time.Now()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			a.senderCollection.metrics.backlog.Set(float64(len(a.lineChannel)))
+			if newConfig != nil {
+				period := a.config.Period
+				a.reload(*newConfig, now)
+				newConfig = nil
+
+				if period != a.config.Period {
+					ticker.Stop()
+					ticker = time.NewTicker(a.config.Period)
+				}
+			} else {
+				a.sending.Add(1)
+				go func() {
+					defer a.sending.Done()
+					a.sendPeriod(now, a.config.Period)
+				}()
+			}
+			periodStart = now
+		case <-reloads:
+			config, err := a.config.Reload()
+			if err != nil {
+				log.Println("config reload failed, previous config is still used. error was:", err)
+				continue
 			}
+			newConfig = &config
+			log.Println("config reloaded. It will be applied at the end of current period")
+		case sig := <-signals:
+			log.Printf("got %s, stopping...\n", sig)
+			a.stop(periodStart)
+			return
+		case <-a.inputDone:
+			log.Println("input is closed, stopping...")
+			a.stop(periodStart)
+			return
 		}
 	}
 }
 
+//openReader opens input and starts reading it to senderCollection in background
 func (a *App) openReader() (err error) {
 
-	a.ir, err = input.GetFileReader(a.config.InputDsn)
-	return err
+	ir, err := input.GetFileReader(a.config.InputDsn)
+	if err != nil {
+		return err
+	}
+
+	if a.config.InputState != "" {
+		c, ok := ir.(input.Checkpointer)
+		if !ok {
+			ir.Close()
+			return errInputState
+		}
+		if err = c.Resume(a.config.InputState); err != nil {
+			ir.Close()
+			return err
+		}
+	}
+
+	lineChannel := make(chan input.Line, lineChannelSize)
+	inputDone := make(chan struct{})
+	go ir.ReadToChannel(lineChannel)
+	go func() {
+		a.appendLine(lineChannel)
+		close(inputDone)
+	}()
+
+	a.m.Lock()
+	a.ir = ir
+	a.inputDone = inputDone
+	a.lineChannel = lineChannel
+	a.m.Unlock()
+	atomic.StoreInt64(&a.inputOpened, time.Now().UnixNano())
+
+	return nil
 }
 
-func (a *App) stop() {
-	os.Exit(0)
+//reload sends stats of current period and replaces filters and outputs with new config.
+//Input is reopened only if its dsn was changed
+func (a *App) reload(config Config, now time.Time) {
+	a.sending.Wait()
+
+	a.m.Lock()
+	positions := a.senderCollection.sendStats(now, a.config.Period)
+	a.senderCollection.close()
+
+	prevConfig := a.config
+	a.config = config
+	senderCollection, err := NewSenderCollection(&a.config)
+	if err != nil {
+		log.Println("new config can't be applied, previous config is still used. error was:", err)
+		a.config = prevConfig
+		senderCollection, err = NewSenderCollection(&a.config)
+		checkOrFail(err)
+	}
+	a.senderCollection = senderCollection
+	a.m.Unlock()
+
+	if a.config.InputDsn == prevConfig.InputDsn && a.config.InputState == prevConfig.InputState {
+		a.checkpoint(positions)
+		log.Println("new config applied")
+		return
+	}
+
+	//openReader replaces input only if new one is opened
+	prevReader, prevInputDone := a.ir, a.inputDone
+	if err = a.openReader(); err != nil {
+		log.Println("new input can't be opened, previous input is still used. error was:", err)
+		a.m.Lock()
+		a.config.InputDsn = prevConfig.InputDsn
+		a.config.InputState = prevConfig.InputState
+		a.m.Unlock()
+		a.checkpoint(positions)
+		return
+	}
+
+	//lines of previous input appended after sendStats are sent by new senderCollection,
+	//so they are read again after restart if state file is the same
+	prevReader.Close()
+	<-prevInputDone
+	checkpoint(prevReader, positions)
+	log.Println("new config applied, input was reopened")
+}
+
+//stop closes input, waits until all read lines are appended and sends stats of last partial period
+func (a *App) stop(periodStart time.Time) {
+	a.ir.Close()
+	<-a.inputDone
+
+	a.sending.Wait()
+	now := time.Now()
+	positions := a.senderCollection.sendStats(now, now.Sub(periodStart))
+	a.senderCollection.close()
+	a.checkpoint(positions)
+	log.Println("stopped")
+}
+
+//sendPeriod sends stats of period and saves positions of sent lines. It runs in parallel with reading,
+//but not with other sendPeriod: a slow sending would save its positions after positions of the next period
+func (a *App) sendPeriod(now time.Time, elapsed time.Duration) {
+	a.sendM.Lock()
+	defer a.sendM.Unlock()
+	a.checkpoint(a.senderCollection.sendStats(now, elapsed))
+}
+
+//checkpoint saves positions of lines sent by senderCollection if input supports it
+func (a *App) checkpoint(positions []input.Position) {
+	a.m.RLock()
+	ir := a.ir
+	a.m.RUnlock()
+	checkpoint(ir, positions)
 }
 
-func (a *App) init() {
+func checkpoint(ir input.BufferedReader, positions []input.Position) {
+	if c, ok := ir.(input.Checkpointer); ok {
+		if err := c.Checkpoint(positions); err != nil {
+			log.Println("input state save error:", err)
+		}
+	}
+}
+
+func (a *App) init() (err error) {
 	a.buffer = []byte{}
-	a.senderCollection = NewSenderCollection(&a.config)
+	a.senderCollection, err = NewSenderCollection(&a.config)
+	return err
 }
 
-func (a *App) appendLine(linesChannel <-chan string) {
+func (a *App) appendLine(linesChannel <-chan input.Line) {
 	var (
+		line      input.Line
 		rawString string
 		err       error
 		logRow    *RowEntry
 		more      bool
 	)
 	for {
-		rawString, more = <-linesChannel
+		line, more = <-linesChannel
 
 		if !more {
 			break
 		}
+		rawString = line.Text
 
-		logRow, err = NewRow(rawString, a.config.Rex)
+		a.m.RLock()
+		a.senderCollection.metrics.linesRead.Inc()
+		start := time.Now()
+		atomic.StoreInt64(&a.lastLine, start.UnixNano())
+		logRow, err = a.config.Parser.Parse(rawString)
+		a.senderCollection.metrics.parse.ObserveSince(start)
 
 		if err != nil && err == errEmptyResult {
+			a.senderCollection.appendUnmatched(line)
+			a.m.RUnlock()
 			continue
 		}
 		checkOrFail(err)
 
-		a.senderCollection.appendData(logRow)
+		if _, ok := logRow.Fields[FileField]; !ok && line.File != "" {
+			logRow.Fields[FileField] = line.File
+		}
+		a.senderCollection.appendData(logRow, line.Position)
+		a.m.RUnlock()
 	}
 }
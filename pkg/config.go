@@ -1,13 +1,20 @@
 package pkg
 
 import (
+	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"github.com/blackbass1988/access_logs_stats/pkg/grok"
+	"github.com/blackbass1988/access_logs_stats/pkg/logformat"
 	"github.com/blackbass1988/access_logs_stats/pkg/re"
 	"github.com/blackbass1988/access_logs_stats/pkg/template"
 	"gopkg.in/yaml.v2"
 	"io/ioutil"
+	"log"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -15,6 +22,8 @@ import (
 //Config base struct of parser config
 type Config struct {
 	InputDsn string
+	//InputState is a state file of file input with position of read lines. Empty if position is not saved
+	InputState string
 
 	ExitAfterOneTick bool
 
@@ -22,38 +31,198 @@ type Config struct {
 	Aggregates   map[string]bool
 	TemplateVars map[string]string
 
+	//Sketches contains relative error of aggregate fields which are collected with DDSketch
+	//instead of storing every value
+	Sketches map[string]float64
+
 	Outputs []*outputConfig
+
+	SelfMetrics SelfMetricsConfig
+	//UnmatchedSample is nil if unmatched lines are not sampled
+	UnmatchedSample *UnmatchedSampleConfig
+
+	Health HealthConfig
+	//Checksum is sha256 of config file. It is reported by /healthz to check which config is applied
+	Checksum string
+
+	//Rex is the first of Regexps
 	Rex     re.RegExp
+	Regexps []RegexpFormat
+	Parser  Parser
 	Period  time.Duration
 	Filters []*Filter
+
+	//filepath and externalTemplateVars are kept to reload config
+	filepath             string
+	externalTemplateVars map[string]string
 }
 
 type outputConfig struct {
+	//Name is used by filters to route messages. By default it is equal to Type
+	Name     string            `json:"name" yaml:"name"`
 	Type     string            `json:"type" yaml:"type"`
 	Settings map[string]string `json:"settings" yaml:"settings"`
 }
 
+//regexpItem is an element of "regexp" list of config. It is set as string or as object with regexp and format
+type regexpItem struct {
+	Regexp string `json:"regexp" yaml:"regexp"`
+	Format string `json:"format" yaml:"format"`
+}
+
+//regexpList is a "regexp" of config. It is set as string or as list of regexpItem
+type regexpList []regexpItem
+
+//UnmarshalJSON reads regexpList from string or list
+func (l *regexpList) UnmarshalJSON(data []byte) error {
+	var items []regexpItem
+	if err := json.Unmarshal(data, &items); err != nil {
+		var item regexpItem
+		if err := json.Unmarshal(data, &item); err != nil {
+			return err
+		}
+		items = []regexpItem{item}
+	}
+	return l.set(items)
+}
+
+//UnmarshalYAML reads regexpList from string or list
+func (l *regexpList) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var items []regexpItem
+	if err := unmarshal(&items); err != nil {
+		var item regexpItem
+		if err := unmarshal(&item); err != nil {
+			return err
+		}
+		items = []regexpItem{item}
+	}
+	return l.set(items)
+}
+
+func (l *regexpList) set(items []regexpItem) error {
+	if len(items) == 1 && items[0].Regexp == "" && items[0].Format == "" {
+		//empty "regexp" is the same as absent
+		*l = nil
+		return nil
+	}
+
+	*l = items
+	for _, item := range items {
+		if item.Regexp == "" {
+			return errors.New("regexp list contains empty regexp")
+		}
+	}
+	return nil
+}
+
+//UnmarshalJSON reads regexpItem from string or object
+func (i *regexpItem) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &i.Regexp); err == nil {
+		return nil
+	}
+
+	type plain regexpItem
+	return json.Unmarshal(data, (*plain)(i))
+}
+
+//UnmarshalYAML reads regexpItem from string or object
+func (i *regexpItem) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if err := unmarshal(&i.Regexp); err == nil {
+		return nil
+	}
+
+	type plain regexpItem
+	return unmarshal((*plain)(i))
+}
+
 type configStruct struct {
-	InputDsn   string   `json:"input" yaml:"input"`
-	Regexp     string   `json:"regexp" yaml:"regexp"`
-	Period     string   `json:"period" yaml:"period"`
-	Counts     []string `json:"counts" yaml:"counts"`
-	Aggregates []string `json:"aggregates" yaml:"aggregates"`
+	InputDsn   string     `json:"input" yaml:"input"`
+	InputState string     `json:"input_state" yaml:"input_state"`
+	Regexp     regexpList `json:"regexp" yaml:"regexp"`
+	Period     string     `json:"period" yaml:"period"`
+	Counts     []string   `json:"counts" yaml:"counts"`
+	Aggregates []string   `json:"aggregates" yaml:"aggregates"`
+
+	//RegexpEngine is an engine of Regexp: pcre or native. Default engine of binary if empty
+	RegexpEngine string `json:"regexp_engine" yaml:"regexp_engine"`
+
+	//GrokPatterns is a list of files with user grok patterns for Regexp
+	GrokPatterns []string `json:"grok_patterns" yaml:"grok_patterns"`
+
+	//Parser is a name of parser of input lines: regexp (default), json, logfmt or ltsv
+	Parser string `json:"parser" yaml:"parser"`
+
+	//NginxLogFormat and ApacheLogFormat are alternatives to Regexp. Regexp is generated from them
+	NginxLogFormat  string `json:"nginx_log_format" yaml:"nginx_log_format"`
+	ApacheLogFormat string `json:"apache_log_format" yaml:"apache_log_format"`
 
 	Filters []*Filter       `json:"filters" yaml:"filters"`
 	Outputs []*outputConfig `json:"output" yaml:"output"`
 
 	TemplateVars map[string]string `json:"template_vars" yaml:"template_vars"`
+
+	SelfMetrics     SelfMetricsConfig      `json:"self_metrics" yaml:"self_metrics"`
+	UnmatchedSample *UnmatchedSampleConfig `json:"unmatched_sample" yaml:"unmatched_sample"`
+	Health          healthConfigStruct     `json:"health" yaml:"health"`
+}
+
+//Reload reads config again from the same file with the same external template vars
+func (c Config) Reload() (Config, error) {
+	config, err := NewConfig(c.filepath, c.externalTemplateVars)
+	config.ExitAfterOneTick = c.ExitAfterOneTick
+	return config, err
+}
+
+//NewConfigs returns Config of file path or Configs of all *.json and *.yaml files if path is a directory
+func NewConfigs(path string, externalTemplateVarsMap map[string]string) (configs []Config, err error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if !fi.IsDir() {
+		config, err := NewConfig(path, externalTemplateVarsMap)
+		if err != nil {
+			return nil, err
+		}
+		return []Config{config}, nil
+	}
+
+	files, err := ioutil.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, f := range files {
+		ext := filepath.Ext(f.Name())
+		if f.IsDir() || ext != ".json" && ext != ".yaml" {
+			continue
+		}
+
+		config, err := NewConfig(filepath.Join(path, f.Name()), externalTemplateVarsMap)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", f.Name(), err)
+		}
+		configs = append(configs, config)
+	}
+
+	if len(configs) == 0 {
+		return nil, fmt.Errorf("there are no *.json or *.yaml configs in %s", path)
+	}
+	return configs, nil
 }
 
 //NewConfig parse config filepath and return new Config
 func NewConfig(filepath string, externalTemplateVarsMap map[string]string) (config Config, err error) {
 	configStruct := new(configStruct)
+	config.filepath = filepath
+	config.externalTemplateVars = externalTemplateVarsMap
 	config.Aggregates = make(map[string]bool)
 	config.Counts = make(map[string]bool)
+	config.Sketches = make(map[string]float64)
 
-	//we need to lock file in processlist for restore by file descriptor if delete in runtime
-	_, err = os.Open(filepath)
+	//config is read again on every reload, so file is not kept open
+	_, err = os.Stat(filepath)
 
 	if err != nil {
 		return config, err
@@ -63,6 +232,7 @@ func NewConfig(filepath string, externalTemplateVarsMap map[string]string) (conf
 	if err != nil {
 		return config, err
 	}
+	config.Checksum = fmt.Sprintf("%x", sha256.Sum256(bytes))
 
 	//filename can doesn't have "yaml" substring. dirty hack. === in start checkOrFail
 	if strings.Contains(filepath, ".yaml") || bytes[0] == 45 && bytes[1] == 45 && bytes[2] == 45 {
@@ -99,32 +269,85 @@ func NewConfig(filepath string, externalTemplateVarsMap map[string]string) (conf
 		return config, err
 	}
 
+	config.InputState = configStruct.InputState
+
 	config.Period, err = time.ParseDuration(configStruct.Period)
 	if err != nil {
 		return config, err
 	}
 
-	config.Rex, err = re.Compile(configStruct.Regexp)
+	regexps, err := getRegexps(configStruct)
+	if err != nil {
+		return config, err
+	}
+
+	if configStruct.Parser != "" && configStruct.Parser != "regexp" {
+		if len(regexps) > 0 {
+			return config, errRegexpAndParser
+		}
+	} else {
+		if len(regexps) == 0 {
+			//absent regexp matches every line without fields
+			regexps = []regexpItem{{}}
+		}
+
+		for _, item := range regexps {
+			rex, err := re.CompileEngine(item.Regexp, configStruct.RegexpEngine)
+			if err != nil {
+				return config, err
+			}
+			config.Regexps = append(config.Regexps, RegexpFormat{Rex: rex, Format: item.Format})
+		}
+		config.Rex = config.Regexps[0].Rex
+	}
+
+	config.Parser, err = newParser(configStruct.Parser, config.Regexps)
 	if err != nil {
 		return config, err
 	}
 
 	config.Outputs = configStruct.Outputs
+	config.SelfMetrics = configStruct.SelfMetrics
+	config.UnmatchedSample = configStruct.UnmatchedSample
+
+	config.Health, err = newHealthConfig(configStruct.Health)
+	if err != nil {
+		return config, err
+	}
+
+	if err = processOutputs(config.Outputs); err != nil {
+		return config, err
+	}
 
 	for _, el := range configStruct.Counts {
 		config.Counts[el] = true
 	}
 
 	for _, el := range configStruct.Aggregates {
-		config.Aggregates[el] = true
+		field, relativeError, err := parseAggregate(el)
+		if err != nil {
+			return config, err
+		}
+
+		config.Aggregates[field] = true
+		if relativeError > 0 {
+			config.Sketches[field] = relativeError
+		}
 	}
 
-	config.Filters = processFilters(configStruct.Filters, config.Counts, config.Aggregates)
+	config.Filters, err = processFilters(configStruct.Filters, config.Counts, config.Aggregates, configStruct.RegexpEngine)
+	if err != nil {
+		return config, err
+	}
 
 	if len(config.Filters) == 0 {
 		err = errFiltersNotSet
 	}
 
+	if err == nil {
+		err = checkFilterOutputs(config.Filters, config.Outputs)
+	}
+
 	if len(config.Outputs) == 0 {
 		return config, errOutputNotSet
 	}
@@ -132,12 +355,79 @@ func NewConfig(filepath string, externalTemplateVarsMap map[string]string) (conf
 	return config, err
 }
 
-func processFilters(filters []*Filter, counts map[string]bool, aggregates map[string]bool) []*Filter {
+//getRegexps returns "regexp" list of config or regexp generated from log format
+func getRegexps(configStruct *configStruct) ([]regexpItem, error) {
+	set := 0
+	for _, v := range []bool{len(configStruct.Regexp) > 0, configStruct.NginxLogFormat != "", configStruct.ApacheLogFormat != ""} {
+		if v {
+			set++
+		}
+	}
+	if set > 1 {
+		return nil, errRegexpAndLogFormat
+	}
+
+	var (
+		regexp string
+		err    error
+	)
+
+	switch {
+	case configStruct.NginxLogFormat != "":
+		regexp, err = logformat.Nginx(configStruct.NginxLogFormat)
+	case configStruct.ApacheLogFormat != "":
+		regexp, err = logformat.Apache(configStruct.ApacheLogFormat)
+	default:
+		return expandGroks(configStruct.Regexp, configStruct.GrokPatterns)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("log format was translated to regexp %s\n", regexp)
+	return []regexpItem{{Regexp: regexp}}, nil
+}
+
+//expandGroks expands grok expressions of regexp list
+func expandGroks(regexps regexpList, patternFiles []string) ([]regexpItem, error) {
+	result := make([]regexpItem, len(regexps))
+
+	for i, item := range regexps {
+		result[i] = item
+		if !grok.IsGrok(item.Regexp) {
+			continue
+		}
+
+		expanded, err := expandGrok(item.Regexp, patternFiles)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("grok was translated to regexp %s\n", expanded)
+		result[i].Regexp = expanded
+	}
+	return result, nil
+}
+
+//expandGrok expands grok expression with bundled and user patterns
+func expandGrok(expression string, patternFiles []string) (string, error) {
+	g := grok.New()
+	for _, path := range patternFiles {
+		if err := g.AddPatternsFromFile(path); err != nil {
+			return "", err
+		}
+	}
+	return g.Expand(expression)
+}
+
+func processFilters(filters []*Filter, counts map[string]bool, aggregates map[string]bool, engine string) ([]*Filter, error) {
 
 	var err error
 	var configFilters []*Filter
 
 	for _, f := range filters {
+		if err = f.compile(engine); err != nil {
+			return nil, err
+		}
 
 		for _, filterItem := range f.Items {
 			for _, metric := range filterItem.Metrics {
@@ -162,8 +452,84 @@ func processFilters(filters []*Filter, counts map[string]bool, aggregates map[st
 			}
 		}
 
-		checkOrFail(err)
+		if err != nil {
+			return nil, err
+		}
 		configFilters = append(configFilters, f)
 	}
-	return configFilters
+	return configFilters, nil
+}
+
+//parseAggregate parses aggregate in format field[:backend[:relative_error]].
+//backend is "exact" (all values are stored) or "ddsketch". relativeError is 0 for exact backend
+func parseAggregate(aggregate string) (field string, relativeError float64, err error) {
+	parts := strings.Split(aggregate, ":")
+	field = parts[0]
+
+	if len(parts) == 1 || parts[1] == "exact" && len(parts) == 2 {
+		return field, 0, nil
+	}
+
+	if parts[1] != "ddsketch" || len(parts) > 3 {
+		return field, 0, fmt.Errorf("aggregate \"%s\" is incorrect. Valid formats are "+
+			"field, field:exact, field:ddsketch and field:ddsketch:relative_error", aggregate)
+	}
+
+	relativeError = DefaultSketchRelativeError
+	if len(parts) == 3 {
+		relativeError, err = strconv.ParseFloat(parts[2], 64)
+		if err != nil || relativeError <= 0 || relativeError >= 1 {
+			return field, 0, fmt.Errorf("aggregate \"%s\" is incorrect. "+
+				"Relative error must be between 0 and 1", aggregate)
+		}
+	}
+	return field, relativeError, nil
+}
+
+//processOutputs checks that names of outputs are unique and names unnamed outputs
+func processOutputs(outputs []*outputConfig) error {
+	names := make(map[string]bool)
+
+	for _, o := range outputs {
+		if o.Name == "" {
+			continue
+		}
+		if names[o.Name] {
+			return fmt.Errorf("output name \"%s\" is not unique", o.Name)
+		}
+		names[o.Name] = true
+	}
+
+	//unnamed output is named by type. Next unnamed outputs of the same type get number: zabbix, zabbix#2, zabbix#3
+	for _, o := range outputs {
+		if o.Name != "" {
+			continue
+		}
+
+		o.Name = o.Type
+		for i := 2; names[o.Name]; i++ {
+			o.Name = fmt.Sprintf("%s#%d", o.Type, i)
+		}
+		names[o.Name] = true
+	}
+	return nil
+}
+
+func checkFilterOutputs(filters []*Filter, outputs []*outputConfig) error {
+	for _, f := range filters {
+		for _, name := range f.Outputs {
+			found := false
+			for _, o := range outputs {
+				if o.Name == name {
+					found = true
+					break
+				}
+			}
+
+			if !found {
+				return fmt.Errorf("filter \"%s\" refers to unknown output \"%s\"", f.String(), name)
+			}
+		}
+	}
+	return nil
 }
@@ -1,7 +1,14 @@
 package pkg_test
 
 import (
+	"fmt"
 	"github.com/blackbass1988/access_logs_stats/pkg"
+	"github.com/blackbass1988/access_logs_stats/pkg/re"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 	"testing"
 )
 
@@ -135,3 +142,326 @@ func checkConfig(t *testing.T, config pkg.Config) {
 		t.Error("config.Aggregates[time]. Expected time. Actual ", config.Aggregates["time"])
 	}
 }
+
+//baseSections are top-level sections of valid config in YAML flow style. Tests replace some of them
+var baseSections = map[string]string{
+	"input":   "file:foo.txt",
+	"regexp":  `'(?P<status>\d+)'`,
+	"period":  "10s",
+	"counts":  "[status]",
+	"filters": `[{filter: ".+", items: [{field: status, metrics: [cps_200]}]}]`,
+	"output":  "[{type: console, settings: {}}]",
+}
+
+//configYAML returns YAML config of baseSections replaced by sections. Empty section is removed
+func configYAML(sections map[string]string) string {
+	merged := make(map[string]string)
+	for name, value := range baseSections {
+		merged[name] = value
+	}
+	for name, value := range sections {
+		merged[name] = value
+	}
+
+	names := make([]string, 0, len(merged))
+	for name := range merged {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString("---\n")
+	for _, name := range names {
+		if merged[name] != "" {
+			fmt.Fprintf(&b, "%s: %s\n", name, merged[name])
+		}
+	}
+	return b.String()
+}
+
+func writeTempFile(t *testing.T, pattern string, content string) string {
+	f, err := ioutil.TempFile("", pattern)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if _, err = f.WriteString(content); err != nil {
+		t.Fatal(err)
+	}
+	return f.Name()
+}
+
+//newTestConfig makes config of baseSections replaced by sections
+func newTestConfig(t *testing.T, sections map[string]string) (pkg.Config, error) {
+	filepath := writeTempFile(t, "als_config_*.yaml", configYAML(sections))
+	defer os.Remove(filepath)
+	return pkg.NewConfig(filepath, nil)
+}
+
+func TestConfigSections(t *testing.T) {
+	cases := []struct {
+		name     string
+		sections map[string]string
+		line     string
+		expected map[string]string
+	}{
+		{
+			"nginx_log_format",
+			map[string]string{"regexp": "", "nginx_log_format": `'$remote_addr [$time_local] "$request" $status $request_time'`},
+			`127.0.0.1 [18/Oct/2026:10:00:00 +0300] "GET / HTTP/1.1" 200 0.001`,
+			map[string]string{"status": "200", "request_time": "0.001"},
+		},
+		{
+			"apache_log_format",
+			map[string]string{"regexp": "", "apache_log_format": "combined"},
+			`127.0.0.1 - - [18/Oct/2026:10:00:00 +0300] "GET / HTTP/1.1" 200 512 "-" "curl/7.68.0"`,
+			map[string]string{"status": "200", "http_user_agent": "curl/7.68.0"},
+		},
+		{
+			"grok",
+			map[string]string{"regexp": `'%{IPORHOST:client} %{INT:status} %{NUMBER:time}'`},
+			"10.0.0.1 200 0.015",
+			map[string]string{"client": "10.0.0.1", "status": "200", "time": "0.015"},
+		},
+		{
+			"json parser",
+			map[string]string{"regexp": "", "parser": "json"},
+			`{"status": 200}`,
+			map[string]string{"status": "200"},
+		},
+	}
+
+	for _, c := range cases {
+		config, err := newTestConfig(t, c.sections)
+		if err != nil {
+			t.Errorf("%s: %s", c.name, err)
+			continue
+		}
+
+		row, err := config.Parser.Parse(c.line)
+		if err != nil {
+			t.Errorf("%s: %s", c.name, err)
+			continue
+		}
+
+		for k, v := range c.expected {
+			if row.Fields[k] != v {
+				t.Errorf("%s: field %s expected %s, actual %v", c.name, k, v, row.Fields)
+			}
+		}
+	}
+}
+
+func TestConfigErrors(t *testing.T) {
+	cases := []struct {
+		name     string
+		sections map[string]string
+	}{
+		{"unknown output of filter", map[string]string{
+			"filters": `[{filter: ".+", outputs: [zabbix-dev], items: [{field: status, metrics: [cps_200]}]}]`,
+		}},
+		{"unknown aggregate backend", map[string]string{"aggregates": "['status:tdigest']"}},
+		{"relative error out of range", map[string]string{"aggregates": "['status:ddsketch:2']"}},
+		{"invalid relative error", map[string]string{"aggregates": "['status:ddsketch:x']"}},
+		{"invalid where", map[string]string{
+			"filters": `[{filter: ".+", where: "code >= and", items: [{field: status, metrics: [cps_200]}]}]`,
+		}},
+		{"regexp and nginx_log_format", map[string]string{"nginx_log_format": "'$status'"}},
+		{"nginx_log_format and apache_log_format", map[string]string{
+			"regexp": "", "nginx_log_format": "'$status'", "apache_log_format": "common",
+		}},
+		{"unknown grok pattern", map[string]string{"regexp": "'%{STATUS:status}'"}},
+		{"absent grok patterns file", map[string]string{
+			"regexp": "'%{INT:status}'", "grok_patterns": "[/nonexistent/als.grok]",
+		}},
+		{"unknown regexp engine", map[string]string{"regexp_engine": "onig"}},
+		{"json parser with regexp", map[string]string{"parser": "json"}},
+		{"unknown parser", map[string]string{"regexp": "", "parser": "xml"}},
+	}
+
+	for _, c := range cases {
+		if _, err := newTestConfig(t, c.sections); err == nil {
+			t.Errorf("%s: config must fail", c.name)
+		}
+	}
+}
+
+func TestOutputNames(t *testing.T) {
+	cases := []struct {
+		outputs  string
+		expected []string
+	}{
+		{"[{type: console}, {type: zabbix}]", []string{"console", "zabbix"}},
+		{"[{type: zabbix}, {type: zabbix, name: staging}]", []string{"zabbix", "staging"}},
+		{"[{type: zabbix}, {type: zabbix}, {type: zabbix}]", []string{"zabbix", "zabbix#2", "zabbix#3"}},
+		{"[{type: zabbix}, {type: console, name: zabbix}]", []string{"zabbix#2", "zabbix"}},
+		{"[{type: zabbix, name: prod}, {type: console, name: prod}]", nil},
+	}
+
+	for _, c := range cases {
+		config, err := newTestConfig(t, map[string]string{"output": c.outputs})
+		if c.expected == nil {
+			if err == nil {
+				t.Errorf("outputs %s must fail", c.outputs)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("outputs %s must be valid, error: %s", c.outputs, err)
+			continue
+		}
+
+		var names []string
+		for _, o := range config.Outputs {
+			names = append(names, o.Name)
+		}
+		if fmt.Sprint(names) != fmt.Sprint(c.expected) {
+			t.Errorf("outputs %s expected names %v, actual %v", c.outputs, c.expected, names)
+		}
+	}
+}
+
+func TestConfigDirectory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "als_conf_d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for name, content := range map[string]string{
+		"api.yaml":    configYAML(nil),
+		"static.yaml": configYAML(map[string]string{"input": "file:bar.txt"}),
+		"README":      "not a config",
+	} {
+		if err = ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	configs, err := pkg.NewConfigs(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(configs) != 2 {
+		t.Errorf("expected 2 configs, actual %d", len(configs))
+	}
+
+	configs, err = pkg.NewConfigs("../config.json.example", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(configs) != 1 {
+		t.Errorf("expected 1 config for file, actual %d", len(configs))
+	}
+}
+
+func TestAggregateBackends(t *testing.T) {
+	config, err := newTestConfig(t, map[string]string{
+		"regexp":     `'(?P<time>\d+) (?P<bytes>\d+) (?P<upstream>\d+)'`,
+		"aggregates": `['time:ddsketch', 'bytes:ddsketch:0.005', 'upstream:exact']`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, field := range []string{"time", "bytes", "upstream"} {
+		if !config.Aggregates[field] {
+			t.Errorf("config.Aggregates[%s] must be set", field)
+		}
+	}
+
+	if config.Sketches["time"] != pkg.DefaultSketchRelativeError {
+		t.Errorf("time relative error must be default, was %f", config.Sketches["time"])
+	}
+
+	if config.Sketches["bytes"] != 0.005 {
+		t.Errorf("bytes relative error must be 0.005, was %f", config.Sketches["bytes"])
+	}
+
+	if _, ok := config.Sketches["upstream"]; ok {
+		t.Error("upstream must be exact")
+	}
+}
+
+func TestRegexpEngine(t *testing.T) {
+	config, err := newTestConfig(t, map[string]string{"regexp_engine": "native"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := config.Rex.(*re.NativeRegExp); !ok {
+		t.Errorf("expected native regexp, actual %T", config.Rex)
+	}
+}
+
+func TestRegexpList(t *testing.T) {
+	config, err := newTestConfig(t, map[string]string{
+		"regexp": `[{regexp: '^(?P<status>\d{3}) (?P<request_time>[\d.]+)$', format: new}, '^(?P<status>\d{3})$']`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkRegexpList(t, config, "new")
+
+	filepath := writeTempFile(t, "als_config_*.json", `{
+  "input": "file:foo.txt",
+  "regexp": [{"regexp": "^(?P<status>\\d{3}) (?P<request_time>[\\d.]+)$", "format": "v2"}, "^(?P<status>\\d{3})$"],
+  "period": "10s",
+  "counts": ["status"],
+  "filters": [{"filter": ".+", "items": [{"field": "status", "metrics": ["cps_200"]}]}],
+  "output": [{"type": "console", "settings": {}}]
+}`)
+	defer os.Remove(filepath)
+
+	config, err = pkg.NewConfig(filepath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkRegexpList(t, config, "v2")
+}
+
+func checkRegexpList(t *testing.T, config pkg.Config, format string) {
+	if len(config.Regexps) != 2 || config.Rex != config.Regexps[0].Rex {
+		t.Fatalf("expected 2 regexps, actual %v", config.Regexps)
+	}
+
+	row, err := config.Parser.Parse("200 0.015")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if row.Fields["request_time"] != "0.015" || row.Fields[pkg.FormatField] != format {
+		t.Errorf("first regexp must match with format %s, actual fields %v", format, row.Fields)
+	}
+
+	row, err = config.Parser.Parse("404")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if row.Fields["status"] != "404" {
+		t.Errorf("second regexp must match, actual fields %v", row.Fields)
+	}
+	if _, ok := row.Fields[pkg.FormatField]; ok {
+		t.Errorf("second regexp has no format, actual fields %v", row.Fields)
+	}
+
+	if _, err = config.Parser.Parse("unknown line"); err == nil {
+		t.Error("line which doesn't match any regexp must not be parsed")
+	}
+}
+
+func TestSelfMetricsConfig(t *testing.T) {
+	config, err := newTestConfig(t, map[string]string{
+		"self_metrics":     "{outputs: true}",
+		"unmatched_sample": "{limit: 5}",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !config.SelfMetrics.Outputs || config.UnmatchedSample == nil || config.UnmatchedSample.Limit != 5 {
+		t.Errorf("incorrect self metrics config %+v %+v", config.SelfMetrics, config.UnmatchedSample)
+	}
+}
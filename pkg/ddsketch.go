@@ -0,0 +1,174 @@
+package pkg
+
+import (
+	"math"
+	"sort"
+)
+
+const (
+	//DefaultSketchRelativeError is a relative error of DDSketch if it is not set in config
+	DefaultSketchRelativeError = 0.01
+
+	//sketchMaxBins bounds memory of DDSketch. Lowest bins are collapsed when it is exceeded
+	sketchMaxBins = 2048
+)
+
+//DDSketch is a streaming quantile sketch with bounded memory.
+//Percentiles have relative error, min, max, sum and len are exact
+//@link https://arxiv.org/abs/1908.10693
+type DDSketch struct {
+	relativeError float64
+	gamma         float64
+	logGamma      float64
+
+	//bins of positive values and of absolute negative values by index
+	positive map[int]uint64
+	negative map[int]uint64
+	zeros    uint64
+
+	count uint64
+	sum   float64
+	min   float64
+	max   float64
+}
+
+//NewDDSketch creates empty DDSketch with relativeError in (0, 1)
+func NewDDSketch(relativeError float64) *DDSketch {
+	gamma := (1 + relativeError) / (1 - relativeError)
+	return &DDSketch{
+		relativeError: relativeError,
+		gamma:         gamma,
+		logGamma:      math.Log(gamma),
+		positive:      make(map[int]uint64),
+		negative:      make(map[int]uint64),
+	}
+}
+
+//Add adds value to sketch
+func (s *DDSketch) Add(v float64) {
+	if s.count == 0 || v < s.min {
+		s.min = v
+	}
+	if s.count == 0 || v > s.max {
+		s.max = v
+	}
+	s.count++
+	s.sum += v
+
+	switch {
+	case v > 0:
+		s.positive[s.index(v)]++
+		if len(s.positive) > sketchMaxBins {
+			collapseLowest(s.positive)
+		}
+	case v < 0:
+		s.negative[s.index(-v)]++
+		if len(s.negative) > sketchMaxBins {
+			collapseLowest(s.negative)
+		}
+	default:
+		s.zeros++
+	}
+}
+
+func (s *DDSketch) index(v float64) int {
+	return int(math.Ceil(math.Log(v) / s.logGamma))
+}
+
+//value returns value of bin with relative error to all values of bin
+func (s *DDSketch) value(index int) float64 {
+	return 2 * math.Pow(s.gamma, float64(index)) / (s.gamma + 1)
+}
+
+//collapseLowest merges two lowest bins
+func collapseLowest(bins map[int]uint64) {
+	lowest, next := math.MaxInt64, math.MaxInt64
+	for i := range bins {
+		if i < lowest {
+			lowest, next = i, lowest
+		} else if i < next {
+			next = i
+		}
+	}
+	bins[next] += bins[lowest]
+	delete(bins, lowest)
+}
+
+//Len returns count of added values
+func (s *DDSketch) Len() int { return int(s.count) }
+
+//Min returns min added value
+func (s *DDSketch) Min() float64 { return s.min }
+
+//Max returns max added value
+func (s *DDSketch) Max() float64 { return s.max }
+
+//Sum returns sum of added values
+func (s *DDSketch) Sum() float64 { return s.sum }
+
+//Avg returns Avg of added values
+func (s *DDSketch) Avg() float64 {
+	if s.count == 0 {
+		return 0
+	}
+	return s.sum / float64(s.count)
+}
+
+//ItemsPerSeconds returns items per second
+func (s *DDSketch) ItemsPerSeconds(seconds float64) float64 {
+	return float64(s.count) / seconds
+}
+
+//Percentile returns x percentile of added values. Rank is the same as in Float64Data.Percentile
+func (s *DDSketch) Percentile(cent float64) float64 {
+	if s.count == 0 {
+		return 0
+	}
+
+	rank := uint64(float64(s.count) * cent / 100)
+	if rank == 0 {
+		return s.min
+	}
+
+	var cnt uint64
+
+	//negative values are ordered from the greatest absolute value
+	for _, i := range sortedIndexes(s.negative, true) {
+		cnt += s.negative[i]
+		if cnt >= rank {
+			return s.clamp(-s.value(i))
+		}
+	}
+
+	cnt += s.zeros
+	if cnt >= rank {
+		return 0
+	}
+
+	for _, i := range sortedIndexes(s.positive, false) {
+		cnt += s.positive[i]
+		if cnt >= rank {
+			return s.clamp(s.value(i))
+		}
+	}
+
+	return s.max
+}
+
+func (s *DDSketch) clamp(v float64) float64 {
+	return math.Max(s.min, math.Min(s.max, v))
+}
+
+func sortedIndexes(bins map[int]uint64, desc bool) []int {
+	indexes := make([]int, 0, len(bins))
+	for i := range bins {
+		indexes = append(indexes, i)
+	}
+
+	if desc {
+		sort.Sort(sort.Reverse(sort.IntSlice(indexes)))
+	} else {
+		sort.Ints(indexes)
+	}
+	return indexes
+}
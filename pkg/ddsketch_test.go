@@ -0,0 +1,87 @@
+package pkg_test
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/blackbass1988/access_logs_stats/pkg"
+)
+
+func TestDDSketch(t *testing.T) {
+	relativeError := 0.01
+	sketch := pkg.NewDDSketch(relativeError)
+
+	r := rand.New(rand.NewSource(1))
+	numbers := []float64{}
+	for i := 0; i < 100000; i++ {
+		//latency-like distribution: most requests are fast, some are very slow
+		v := math.Exp(r.NormFloat64()*1.5 - 3)
+		numbers = append(numbers, v)
+		sketch.Add(v)
+	}
+	sketch.Add(0)
+	numbers = append(numbers, 0)
+
+	floatNumber := pkg.Float64Data(numbers)
+	sort.Sort(floatNumber)
+
+	if sketch.Len() != floatNumber.Len() {
+		t.Errorf("incorrect len. must %d but was %d", floatNumber.Len(), sketch.Len())
+	}
+
+	if sketch.Min() != floatNumber.Min() || sketch.Max() != floatNumber.Max() {
+		t.Errorf("incorrect min/max. must %f/%f but was %f/%f",
+			floatNumber.Min(), floatNumber.Max(), sketch.Min(), sketch.Max())
+	}
+
+	if math.Abs(sketch.Sum()-floatNumber.Sum()) > 1e-6*floatNumber.Sum() {
+		t.Errorf("incorrect sum. must %f but was %f", floatNumber.Sum(), sketch.Sum())
+	}
+
+	if math.Abs(sketch.Avg()-floatNumber.Avg()) > 1e-6*floatNumber.Avg() {
+		t.Errorf("incorrect avg. must %f but was %f", floatNumber.Avg(), sketch.Avg())
+	}
+
+	for _, cent := range []float64{0, 1, 10, 50, 90, 99, 99.9, 100} {
+		expected := floatNumber.Percentile(cent)
+		actual := sketch.Percentile(cent)
+
+		if math.Abs(actual-expected) > relativeError*expected {
+			t.Errorf("incorrect percentile(%.1f). must %f±%.0f%% but was %f",
+				cent, expected, relativeError*100, actual)
+		}
+	}
+}
+
+func TestDDSketchNegative(t *testing.T) {
+	sketch := pkg.NewDDSketch(0.01)
+	for _, v := range []float64{-10, -1, 0, 1, 10} {
+		sketch.Add(v)
+	}
+
+	if sketch.Percentile(20) != -10 {
+		t.Errorf("incorrect percentile(20). must -10 but was %f", sketch.Percentile(20))
+	}
+
+	if p := sketch.Percentile(40); math.Abs(p+1) > 0.01 {
+		t.Errorf("incorrect percentile(40). must -1 but was %f", p)
+	}
+
+	if sketch.Percentile(60) != 0 {
+		t.Errorf("incorrect percentile(60). must 0 but was %f", sketch.Percentile(60))
+	}
+
+	if sketch.Percentile(100) != 10 {
+		t.Errorf("incorrect percentile(100). must 10 but was %f", sketch.Percentile(100))
+	}
+}
+
+func TestDDSketchEmpty(t *testing.T) {
+	sketch := pkg.NewDDSketch(0.01)
+
+	if sketch.Percentile(90) != 0 || sketch.Avg() != 0 || sketch.Max() != 0 {
+		t.Error("empty sketch must return zeros")
+	}
+}
@@ -0,0 +1,161 @@
+//Package expr implements filter expressions over parsed fields of row.
+//
+//Examples:
+//	code >= 500 and vhost in ["api", "m"]
+//	not (method == "GET" or method == "HEAD")
+//	url =~ "^/api/" and upstream != "-"
+//
+//Operators: == != > >= < <= =~ !~ in, not in, not, and, or, parentheses.
+//Comparison with number literal is numeric, row with non-numeric value doesn't match it.
+package expr
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/blackbass1988/access_logs_stats/pkg/re"
+)
+
+//Expression matches fields of row
+type Expression interface {
+	Match(fields map[string]string) bool
+}
+
+//Compile parses expression. Regular expressions of =~ and !~ are compiled by default engine of re
+func Compile(s string) (Expression, error) {
+	return CompileEngine(s, "")
+}
+
+//CompileEngine parses expression. Regular expressions of =~ and !~ are compiled by engine of re
+func CompileEngine(s string, engine string) (Expression, error) {
+	tokens, err := tokenize(s)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens, engine: engine}
+	e, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, fmt.Errorf("unexpected %s at position %d", t, t.pos)
+	}
+	return e, nil
+}
+
+type and struct{ left, right Expression }
+
+func (e *and) Match(fields map[string]string) bool {
+	return e.left.Match(fields) && e.right.Match(fields)
+}
+
+type or struct{ left, right Expression }
+
+func (e *or) Match(fields map[string]string) bool {
+	return e.left.Match(fields) || e.right.Match(fields)
+}
+
+type not struct{ e Expression }
+
+func (e *not) Match(fields map[string]string) bool {
+	return !e.e.Match(fields)
+}
+
+//value is a literal of expression
+type value struct {
+	str      string
+	num      float64
+	isNumber bool
+}
+
+func (v value) equal(s string) bool {
+	if !v.isNumber {
+		return s == v.str
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	return err == nil && f == v.num
+}
+
+type comparison struct {
+	field string
+	op    string
+	value value
+}
+
+func (e *comparison) Match(fields map[string]string) bool {
+	s, ok := fields[e.field]
+	if !ok {
+		return false
+	}
+
+	switch e.op {
+	case "==":
+		return e.value.equal(s)
+	case "!=":
+		return !e.value.equal(s)
+	}
+
+	if !e.value.isNumber {
+		switch e.op {
+		case ">":
+			return s > e.value.str
+		case ">=":
+			return s >= e.value.str
+		case "<":
+			return s < e.value.str
+		default:
+			return s <= e.value.str
+		}
+	}
+
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return false
+	}
+
+	switch e.op {
+	case ">":
+		return f > e.value.num
+	case ">=":
+		return f >= e.value.num
+	case "<":
+		return f < e.value.num
+	default:
+		return f <= e.value.num
+	}
+}
+
+type regexpMatch struct {
+	field  string
+	rex    re.RegExp
+	negate bool
+}
+
+func (e *regexpMatch) Match(fields map[string]string) bool {
+	s, ok := fields[e.field]
+	if !ok {
+		return false
+	}
+	return e.rex.MatchString(s) != e.negate
+}
+
+type in struct {
+	field  string
+	values []value
+}
+
+func (e *in) Match(fields map[string]string) bool {
+	s, ok := fields[e.field]
+	if !ok {
+		return false
+	}
+
+	for _, v := range e.values {
+		if v.equal(s) {
+			return true
+		}
+	}
+	return false
+}
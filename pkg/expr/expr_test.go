@@ -0,0 +1,94 @@
+package expr_test
+
+import (
+	"testing"
+
+	"github.com/blackbass1988/access_logs_stats/pkg/expr"
+)
+
+func TestMatch(t *testing.T) {
+	fields := map[string]string{
+		"code":   "502",
+		"vhost":  "api",
+		"method": "POST",
+		"url":    "/api/v1/users",
+		"time":   "0.250",
+	}
+
+	cases := []struct {
+		expression string
+		expected   bool
+	}{
+		{`code >= 500`, true},
+		{`code < 500`, false},
+		{`code == 502`, true},
+		{`code == "502"`, true},
+		{`code != 502`, false},
+		{`time > 0.2 and time <= 0.25`, true},
+		{`time == 0.25`, true},
+		{`vhost == "api"`, true},
+		{`vhost == 'm'`, false},
+		{`vhost in ["api", "m"]`, true},
+		{`code in [500, 502, 504]`, true},
+		{`vhost not in ["api", "m"]`, false},
+		{`code >= 500 and vhost in ["api","m"]`, true},
+		{`code >= 500 and vhost in ["www"]`, false},
+		{`code < 500 or method == "POST"`, true},
+		{`not (method == "GET" or method == "HEAD")`, true},
+		{`not method == "POST"`, false},
+		{`url =~ "^/api/v\d+/"`, true},
+		{`url !~ "^/api/"`, false},
+		{`method == "GET" or method == "POST" and code >= 500`, true},
+		{`(method == "GET" or method == "POST") and code < 500`, false},
+		{`vhost > 10`, false},
+		{`unknown == ""`, false},
+		{`not unknown == ""`, true},
+	}
+
+	for _, c := range cases {
+		e, err := expr.Compile(c.expression)
+		if err != nil {
+			t.Errorf("%s: %s", c.expression, err)
+			continue
+		}
+
+		if actual := e.Match(fields); actual != c.expected {
+			t.Errorf("%s: expected %v, actual %v", c.expression, c.expected, actual)
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	for _, s := range []string{
+		``,
+		`code`,
+		`code >=`,
+		`code = 500`,
+		`code >= 500 and`,
+		`(code >= 500`,
+		`code in 500`,
+		`code in [500`,
+		`code not 500`,
+		`vhost == "api`,
+		`url =~ "("`,
+		`code >= 500 vhost == "api"`,
+		`500 == code`,
+	} {
+		if _, err := expr.Compile(s); err == nil {
+			t.Errorf("expression %s must fail", s)
+		}
+	}
+}
+
+func TestCompileEngine(t *testing.T) {
+	if _, err := expr.CompileEngine(`url =~ "^/api/"`, "native"); err != nil {
+		t.Error(err)
+	}
+
+	//lookahead is not supported by native engine
+	for _, engine := range []string{"native", "onig"} {
+		if _, err := expr.CompileEngine(`url =~ "^(?=/api/)"`, engine); err == nil {
+			t.Errorf("regular expression of engine %s must fail", engine)
+		}
+	}
+}
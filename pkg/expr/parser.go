@@ -0,0 +1,304 @@
+package expr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/blackbass1988/access_logs_stats/pkg/re"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenString
+	tokenNumber
+	tokenOperator
+	tokenLParen
+	tokenRParen
+	tokenLBracket
+	tokenRBracket
+	tokenComma
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func (t token) String() string {
+	if t.kind == tokenEOF {
+		return "end of expression"
+	}
+	return fmt.Sprintf("\"%s\"", t.text)
+}
+
+//keyword returns true if token is identifier equal to word
+func (t token) keyword(word string) bool {
+	return t.kind == tokenIdent && t.text == word
+}
+
+var operators = []string{"==", "!=", ">=", "<=", "=~", "!~", ">", "<"}
+
+func tokenize(s string) ([]token, error) {
+	var tokens []token
+
+	for i := 0; i < len(s); {
+		c := s[i]
+
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(':
+			tokens = append(tokens, token{tokenLParen, "(", i})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{tokenRParen, ")", i})
+			i++
+		case c == '[':
+			tokens = append(tokens, token{tokenLBracket, "[", i})
+			i++
+		case c == ']':
+			tokens = append(tokens, token{tokenRBracket, "]", i})
+			i++
+		case c == ',':
+			tokens = append(tokens, token{tokenComma, ",", i})
+			i++
+		case c == '"' || c == '\'':
+			str, n, err := readString(s[i:])
+			if err != nil {
+				return nil, fmt.Errorf("%s at position %d", err, i)
+			}
+			tokens = append(tokens, token{tokenString, str, i})
+			i += n
+		case c == '-' || c == '.' || (c >= '0' && c <= '9'):
+			start := i
+			i++
+			for i < len(s) && (s[i] == '.' || s[i] == 'e' || s[i] == 'E' || (s[i] >= '0' && s[i] <= '9') ||
+				((s[i] == '-' || s[i] == '+') && (s[i-1] == 'e' || s[i-1] == 'E'))) {
+				i++
+			}
+			if _, err := strconv.ParseFloat(s[start:i], 64); err != nil {
+				return nil, fmt.Errorf("invalid number \"%s\" at position %d", s[start:i], start)
+			}
+			tokens = append(tokens, token{tokenNumber, s[start:i], start})
+		case c == '_' || unicode.IsLetter(rune(c)):
+			start := i
+			for i < len(s) && (s[i] == '_' || s[i] == '.' || s[i] == '-' ||
+				unicode.IsLetter(rune(s[i])) || unicode.IsDigit(rune(s[i]))) {
+				i++
+			}
+			tokens = append(tokens, token{tokenIdent, s[start:i], start})
+		default:
+			op := ""
+			for _, o := range operators {
+				if strings.HasPrefix(s[i:], o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected symbol '%c' at position %d", c, i)
+			}
+			tokens = append(tokens, token{tokenOperator, op, i})
+			i += len(op)
+		}
+	}
+
+	return append(tokens, token{tokenEOF, "", len(s)}), nil
+}
+
+//readString reads quoted string from beginning of s. Returns string and count of read bytes
+func readString(s string) (string, int, error) {
+	quote := s[0]
+	var b strings.Builder
+
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case quote:
+			return b.String(), i + 1, nil
+		case '\\':
+			if i+1 == len(s) {
+				continue
+			}
+			i++
+			//regexp escapes like \d are kept as is
+			if s[i] != quote && s[i] != '\\' {
+				b.WriteByte('\\')
+			}
+			b.WriteByte(s[i])
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated string")
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+	//engine is a regexp engine of =~ and !~
+	engine string
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) expect(kind tokenKind, what string) (token, error) {
+	t := p.next()
+	if t.kind != kind {
+		return t, fmt.Errorf("expected %s but found %s at position %d", what, t, t.pos)
+	}
+	return t, nil
+}
+
+func (p *parser) parseOr() (Expression, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek().keyword("or") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &or{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (Expression, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek().keyword("and") {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &and{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (Expression, error) {
+	t := p.peek()
+
+	switch {
+	case t.keyword("not"):
+		p.next()
+		e, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &not{e}, nil
+	case t.kind == tokenLParen:
+		p.next()
+		e, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if _, err = p.expect(tokenRParen, "\")\""); err != nil {
+			return nil, err
+		}
+		return e, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (Expression, error) {
+	field, err := p.expect(tokenIdent, "field name")
+	if err != nil {
+		return nil, err
+	}
+
+	t := p.next()
+	switch {
+	case t.keyword("in"):
+		values, err := p.parseList()
+		if err != nil {
+			return nil, err
+		}
+		return &in{field.text, values}, nil
+	case t.keyword("not"):
+		if t = p.next(); !t.keyword("in") {
+			return nil, fmt.Errorf("expected \"in\" but found %s at position %d", t, t.pos)
+		}
+		values, err := p.parseList()
+		if err != nil {
+			return nil, err
+		}
+		return &not{&in{field.text, values}}, nil
+	case t.kind != tokenOperator:
+		return nil, fmt.Errorf("expected operator after field \"%s\" but found %s at position %d", field.text, t, t.pos)
+	}
+
+	v, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+
+	if t.text == "=~" || t.text == "!~" {
+		rex, err := re.CompileEngine(v.str, p.engine)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression \"%s\": %s", v.str, err)
+		}
+		return &regexpMatch{field.text, rex, t.text == "!~"}, nil
+	}
+
+	return &comparison{field.text, t.text, v}, nil
+}
+
+func (p *parser) parseList() ([]value, error) {
+	if _, err := p.expect(tokenLBracket, "\"[\""); err != nil {
+		return nil, err
+	}
+
+	var values []value
+	for {
+		v, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+
+		t := p.next()
+		if t.kind == tokenRBracket {
+			return values, nil
+		}
+		if t.kind != tokenComma {
+			return nil, fmt.Errorf("expected \",\" or \"]\" but found %s at position %d", t, t.pos)
+		}
+	}
+}
+
+func (p *parser) parseValue() (value, error) {
+	t := p.next()
+
+	switch t.kind {
+	case tokenString:
+		return value{str: t.text}, nil
+	case tokenNumber:
+		num, _ := strconv.ParseFloat(t.text, 64)
+		return value{str: t.text, num: num, isNumber: true}, nil
+	}
+	return value{}, fmt.Errorf("expected string or number but found %s at position %d", t, t.pos)
+}
@@ -1,6 +1,9 @@
 package pkg
 
 import (
+	"encoding/json"
+	"fmt"
+	"github.com/blackbass1988/access_logs_stats/pkg/expr"
 	"github.com/blackbass1988/access_logs_stats/pkg/re"
 	"log"
 	"strings"
@@ -8,23 +11,97 @@ import (
 
 var regularExpressionRex = re.MustCompile(`[\[\]{}+*\\()]`)
 
+const (
+	//DefaultGroupLimit is a max count of groups in period if "group_limit" of filter is not set
+	DefaultGroupLimit = 1000
+
+	//GroupOverflowValue is a value of all group_by fields of group where rows of groups over the limit get to
+	GroupOverflowValue = "__overflow__"
+)
+
 //Filter matching input string
 type Filter struct {
-	Matcher *matcher `json:"filter" yaml:"filter"`
-	Prefix  string   `json:"prefix" yaml:"prefix"`
-	Items   []struct {
-		Field   string   `json:"field" yaml:"field"`
-		Metrics []string `json:"metrics" yaml:"metrics"`
-	} `json:"items" yaml:"items"`
+	Matcher *matcher     `json:"filter" yaml:"filter"`
+	Prefix  string       `json:"prefix" yaml:"prefix"`
+	Items   []FilterItem `json:"items" yaml:"items"`
+
+	//Where is an expression over parsed fields of row, e.g. code >= 500 and vhost in ["api", "m"]
+	Where *where `json:"where" yaml:"where"`
+
+	//Outputs is a list of output names where filter's messages are sent. All outputs if empty
+	Outputs []string `json:"outputs" yaml:"outputs"`
+
+	//GroupBy is a list of fields. Metrics are calculated for every distinct combination of their values
+	GroupBy []string `json:"group_by" yaml:"group_by"`
+	//GroupLimit is a max count of groups in period. DefaultGroupLimit if not set
+	GroupLimit int `json:"group_limit" yaml:"group_limit"`
+}
+
+func (f *Filter) getGroupLimit() int {
+	if f.GroupLimit > 0 {
+		return f.GroupLimit
+	}
+	return DefaultGroupLimit
 }
 
-//MatchString matches input string and return true if str was matches with filter and false if not
+//SendsTo returns true if filter's messages must be sent to output with name
+func (f *Filter) SendsTo(name string) bool {
+	if len(f.Outputs) == 0 {
+		return true
+	}
+
+	for _, o := range f.Outputs {
+		if o == name {
+			return true
+		}
+	}
+	return false
+}
+
+//FilterItem is a field with list of metrics to calculate
+type FilterItem struct {
+	Field   string   `json:"field" yaml:"field"`
+	Metrics []string `json:"metrics" yaml:"metrics"`
+}
+
+//MatchString matches input string and return true if str was matches with filter and false if not.
+//Filter without "filter" matches every string
 func (f *Filter) MatchString(str string) bool {
-	return f.Matcher.matchString(str)
+	return f.Matcher == nil || f.Matcher.matchString(str)
 }
 
-//String returns filter's input string
+//Match returns true if raw string of row matches with filter and its fields match with "where" expression
+func (f *Filter) Match(row *RowEntry) bool {
+	if !f.MatchString(row.Raw) {
+		return false
+	}
+	return f.Where == nil || f.Where.Match(row.Fields)
+}
+
+//compile compiles filter string and where expression with regexp engine of config.
+//They are not compiled by unmarshaller, because engine is not known there yet
+func (f *Filter) compile(engine string) (err error) {
+	if f.Matcher != nil {
+		if *f.Matcher, err = newmatcher(f.Matcher.raw, engine); err != nil {
+			return err
+		}
+	}
+
+	if f.Where != nil {
+		compiled, err := newWhere(f.Where.raw, engine)
+		if err != nil {
+			return err
+		}
+		*f.Where = *compiled
+	}
+	return nil
+}
+
+//String returns filter's input string. It is empty for filter without "filter"
 func (f *Filter) String() string {
+	if f.Matcher == nil {
+		return ""
+	}
 	return f.Matcher.string()
 }
 
@@ -50,7 +127,7 @@ func (m *matcher) string() string {
 	return m.raw
 }
 
-func newmatcher(str string) (matcher, error) {
+func newmatcher(str string, engine string) (matcher, error) {
 	var err error
 	m := matcher{}
 	m.raw = str
@@ -61,26 +138,50 @@ func newmatcher(str string) (matcher, error) {
 	} else if regularExpressionRex.MatchString(str) {
 		m.isRegex = true
 		log.Printf("filter [%s] was recognized as \"regular expersion\"\n", str)
-		m.matcher, err = re.Compile(str)
+		m.matcher, err = re.CompileEngine(str, engine)
 	} else {
 		log.Printf("filter [%s] was recognized as \"string match expression\"\n", str)
 	}
 	return m, err
 }
 
-//UnmarshalJSON return new matcher for JSON unmarshaller
+//UnmarshalJSON keeps filter string for JSON unmarshaller. It is compiled by Filter.compile
 func (m *matcher) UnmarshalJSON(data []byte) (err error) {
-	*m, err = newmatcher(string(data[1 : len(data)-1]))
-	return err
+	*m = matcher{raw: string(data[1 : len(data)-1])}
+	return nil
 }
 
-//UnmarshalJSON return new matcher for YAML unmarshaller
+//UnmarshalYAML keeps filter string for YAML unmarshaller. It is compiled by Filter.compile
 func (m *matcher) UnmarshalYAML(unmarshal func(interface{}) error) (err error) {
 
 	v := ""
 	if err := unmarshal(&v); err != nil {
 		return err
 	}
-	*m, err = newmatcher(v)
-	return err
+	*m = matcher{raw: v}
+	return nil
+}
+
+//where is a compiled "where" expression of filter
+type where struct {
+	expr.Expression
+	raw string
+}
+
+func newWhere(str string, engine string) (*where, error) {
+	e, err := expr.CompileEngine(str, engine)
+	if err != nil {
+		return nil, fmt.Errorf("invalid where expression [%s]: %s", str, err)
+	}
+	return &where{e, str}, nil
+}
+
+//UnmarshalJSON keeps where expression for JSON unmarshaller. It is compiled by Filter.compile
+func (w *where) UnmarshalJSON(data []byte) error {
+	return json.Unmarshal(data, &w.raw)
+}
+
+//UnmarshalYAML keeps where expression for YAML unmarshaller. It is compiled by Filter.compile
+func (w *where) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	return unmarshal(&w.raw)
 }
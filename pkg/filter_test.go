@@ -0,0 +1,78 @@
+package pkg
+
+import (
+	"testing"
+
+	"github.com/blackbass1988/access_logs_stats/pkg/re"
+)
+
+func TestFilterRegexpEngine(t *testing.T) {
+	f := &Filter{Matcher: &matcher{raw: `GET /api/\d+`}, Where: &where{raw: `url =~ "^/api/"`}}
+	if err := f.compile("native"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := f.Matcher.matcher.(*re.NativeRegExp); !ok {
+		t.Errorf("expected native regexp, actual %T", f.Matcher.matcher)
+	}
+	if !f.Match(&RowEntry{Raw: "GET /api/1", Fields: map[string]string{"url": "/api/1"}}) {
+		t.Error("filter must match")
+	}
+
+	for _, f := range []*Filter{
+		{Matcher: &matcher{raw: `GET (?=/api/)`}},
+		{Where: &where{raw: `url =~ "^(?=/api/)"`}},
+	} {
+		if err := f.compile("native"); err == nil {
+			t.Errorf("filter %s with lookahead must fail with native engine", f.String())
+		}
+	}
+}
+
+func TestFilterWhere(t *testing.T) {
+	cases := []struct {
+		filter   string
+		where    string
+		row      RowEntry
+		expected bool
+	}{
+		{".+", `code >= 500 and vhost in ["api", "m"]`, RowEntry{Fields: map[string]string{"code": "502", "vhost": "api"}}, true},
+		{".+", `code >= 500 and vhost in ["api", "m"]`, RowEntry{Fields: map[string]string{"code": "200", "vhost": "api"}}, false},
+		{".+", `code >= 500 and vhost in ["api", "m"]`, RowEntry{Fields: map[string]string{"code": "500", "vhost": "www"}}, false},
+		{"POST", `code >= 500`, RowEntry{Raw: "GET /", Fields: map[string]string{"code": "502"}}, false},
+		{"POST", `code >= 500`, RowEntry{Raw: "POST /", Fields: map[string]string{"code": "502"}}, true},
+	}
+
+	for _, c := range cases {
+		f := &Filter{Matcher: &matcher{raw: c.filter}, Where: &where{raw: c.where}}
+		if err := f.compile(""); err != nil {
+			t.Fatal(err)
+		}
+		if actual := f.Match(&c.row); actual != c.expected {
+			t.Errorf("filter [%s] where [%s], row %v: expected %v, actual %v", c.filter, c.where, c.row.Fields, c.expected, actual)
+		}
+	}
+
+	if err := (&Filter{Where: &where{raw: `code >= and`}}).compile(""); err == nil {
+		t.Error("invalid where expression must fail")
+	}
+}
+
+func TestFilterSendsTo(t *testing.T) {
+	cases := []struct {
+		outputs  []string
+		name     string
+		expected bool
+	}{
+		{nil, "console", true},
+		{[]string{"console", "zabbix-prod"}, "console", true},
+		{[]string{"console", "zabbix-prod"}, "zabbix-prod", true},
+		{[]string{"console", "zabbix-prod"}, "zabbix-staging", false},
+	}
+
+	for _, c := range cases {
+		f := &Filter{Outputs: c.outputs}
+		if actual := f.SendsTo(c.name); actual != c.expected {
+			t.Errorf("outputs %v, SendsTo(%s): expected %v, actual %v", c.outputs, c.name, c.expected, actual)
+		}
+	}
+}
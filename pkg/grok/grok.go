@@ -0,0 +1,119 @@
+//Package grok expands grok expressions like %{IPORHOST:client} into regular expressions with named groups
+package grok
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+//grokRex matches %{PATTERN}, %{PATTERN:field} and %{PATTERN:field:type}. Type is ignored.
+//Names of patterns are upper case, so quantifiers like x%{2} are not patterns
+var grokRex = regexp.MustCompile(`%\{([A-Z_][A-Z0-9_]*)(?::(\w*))?(?::\w+)?\}`)
+
+var lineRex = regexp.MustCompile(`^([A-Z_][A-Z0-9_]*)\s+(.+)$`)
+
+//Grok is a library of patterns
+type Grok struct {
+	patterns map[string]string
+}
+
+//New returns Grok with DefaultPatterns
+func New() *Grok {
+	g := &Grok{patterns: make(map[string]string)}
+	if err := g.AddPatterns(strings.NewReader(DefaultPatterns)); err != nil {
+		panic(err)
+	}
+	return g
+}
+
+//IsGrok returns true if expression contains grok patterns
+func IsGrok(expression string) bool {
+	return grokRex.MatchString(expression)
+}
+
+//AddPatterns reads patterns in logstash patterns file format: "NAME pattern" per line, # for comments.
+//Patterns with the same names are replaced
+func (g *Grok) AddPatterns(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		matches := lineRex.FindStringSubmatch(line)
+		if matches == nil {
+			return fmt.Errorf("invalid pattern at line %d: %s", lineNumber, line)
+		}
+		g.patterns[matches[1]] = matches[2]
+	}
+	return scanner.Err()
+}
+
+//AddPatternsFromFile reads patterns from file. See AddPatterns
+func (g *Grok) AddPatternsFromFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err = g.AddPatterns(f); err != nil {
+		return fmt.Errorf("%s: %s", path, err)
+	}
+	return nil
+}
+
+//Expand replaces grok patterns of expression with regular expressions.
+//%{PATTERN:field} becomes named group "field", %{PATTERN} becomes non-capturing group
+func (g *Grok) Expand(expression string) (string, error) {
+	return g.expand(expression, nil)
+}
+
+func (g *Grok) expand(expression string, stack []string) (string, error) {
+	var err error
+
+	result := grokRex.ReplaceAllStringFunc(expression, func(s string) string {
+		if err != nil {
+			return ""
+		}
+
+		matches := grokRex.FindStringSubmatch(s)
+		name, field := matches[1], matches[2]
+
+		pattern, ok := g.patterns[name]
+		if !ok {
+			err = fmt.Errorf("unknown grok pattern %s", name)
+			return ""
+		}
+
+		for _, parent := range stack {
+			if parent == name {
+				err = fmt.Errorf("grok pattern %s refers to itself: %s", name, strings.Join(append(stack, name), " -> "))
+				return ""
+			}
+		}
+
+		var expanded string
+		expanded, err = g.expand(pattern, append(stack, name))
+		if err != nil {
+			return ""
+		}
+
+		if field == "" {
+			return "(?:" + expanded + ")"
+		}
+		return "(?P<" + field + ">" + expanded + ")"
+	})
+
+	if err != nil {
+		return "", err
+	}
+	return result, nil
+}
@@ -0,0 +1,202 @@
+package grok_test
+
+import (
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/blackbass1988/access_logs_stats/pkg/grok"
+)
+
+func TestExpand(t *testing.T) {
+	cases := []struct {
+		expression string
+		line       string
+		expected   map[string]string
+	}{
+		{
+			`%{IPORHOST:client} - %{USER:user} \[%{HTTPDATE:ts}\] "%{WORD:method} %{URIPATHPARAM:url} HTTP/%{NUMBER}" %{INT:code:int} %{NUMBER:time:float}`,
+			`192.168.1.10 - bob [18/Oct/2026:10:00:00 +0300] "GET /api/v1/users?id=1 HTTP/1.1" 200 0.015`,
+			map[string]string{
+				"client": "192.168.1.10",
+				"user":   "bob",
+				"ts":     "18/Oct/2026:10:00:00 +0300",
+				"method": "GET",
+				"url":    "/api/v1/users?id=1",
+				"code":   "200",
+				"time":   "0.015",
+			},
+		},
+		{
+			`^%{COMBINEDAPACHELOG}$`,
+			`example.com - - [18/Oct/2026:10:00:00 +0300] "POST /login HTTP/2.0" 302 - "https://example.com/" "curl/7.68.0"`,
+			map[string]string{
+				"clientip": "example.com",
+				"verb":     "POST",
+				"request":  "/login",
+				"response": "302",
+				"bytes":    "",
+				"agent":    `"curl/7.68.0"`,
+			},
+		},
+		{
+			`%{TIMESTAMP_ISO8601:ts} %{LOGLEVEL:level} %{UUID:id} %{IP:ip} %{GREEDYDATA:msg}`,
+			`2026-10-18T10:00:00.123+03:00 WARN 123e4567-e89b-12d3-a456-426614174000 2001:db8::1 disk is almost full`,
+			map[string]string{
+				"ts":    "2026-10-18T10:00:00.123+03:00",
+				"level": "WARN",
+				"id":    "123e4567-e89b-12d3-a456-426614174000",
+				"ip":    "2001:db8::1",
+				"msg":   "disk is almost full",
+			},
+		},
+	}
+
+	g := grok.New()
+	for _, c := range cases {
+		expression, err := g.Expand(c.expression)
+		if err != nil {
+			t.Errorf("%s: %s", c.expression, err)
+			continue
+		}
+
+		rex := regexp.MustCompile(expression)
+		matches := rex.FindStringSubmatch(c.line)
+		if matches == nil {
+			t.Errorf("%s doesn't match %s", c.expression, c.line)
+			continue
+		}
+
+		for i, name := range rex.SubexpNames() {
+			if expected, ok := c.expected[name]; ok && matches[i] != expected {
+				t.Errorf("%s: expected %s, actual %s", name, expected, matches[i])
+			}
+		}
+	}
+}
+
+func TestDefaultPatternsCompile(t *testing.T) {
+	g := grok.New()
+	for _, line := range strings.Split(grok.DefaultPatterns, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		expression, err := g.Expand("%{" + fields[0] + "}")
+		if err != nil {
+			t.Errorf("%s: %s", fields[0], err)
+			continue
+		}
+
+		if _, err := regexp.Compile(expression); err != nil {
+			t.Errorf("%s: %s", fields[0], err)
+		}
+	}
+}
+
+func TestUserPatterns(t *testing.T) {
+	g := grok.New()
+	err := g.AddPatterns(strings.NewReader(`
+# comment
+UPSTREAM %{IPORHOST}:%{POSINT}
+NGINXTIME %{NUMBER}
+LOOP %{LOOP2}
+LOOP2 %{LOOP}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expression, err := g.Expand(`%{UPSTREAM:upstream} %{NGINXTIME:time}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	matches := regexp.MustCompile(expression).FindStringSubmatch("10.0.0.1:8080 0.100")
+	if matches == nil || matches[1] != "10.0.0.1:8080" || matches[2] != "0.100" {
+		t.Errorf("incorrect matches %v of %s", matches, expression)
+	}
+
+	for _, bad := range []string{`%{UNKNOWN:x}`, `%{LOOP}`} {
+		if _, err := g.Expand(bad); err == nil {
+			t.Errorf("%s must fail", bad)
+		}
+	}
+
+	for _, bad := range []string{"BROKEN", "lower %{INT}"} {
+		if err := g.AddPatterns(strings.NewReader(bad)); err == nil {
+			t.Errorf("pattern %s must fail", bad)
+		}
+	}
+}
+
+func TestNotPatterns(t *testing.T) {
+	g := grok.New()
+	if err := g.AddPatterns(strings.NewReader(`CODE \d+`)); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		expression string
+		expected   string
+	}{
+		{`x%{2}`, `x%{2}`},
+		{`x%{2,3}`, `x%{2,3}`},
+		{`%{code}`, `%{code}`},
+		{`\d%{3}-%{CODE:code}`, `\d%{3}-(?P<code>\d+)`},
+	}
+
+	for _, c := range cases {
+		expanded, err := g.Expand(c.expression)
+		if err != nil {
+			t.Errorf("%s: %s", c.expression, err)
+			continue
+		}
+		if expanded != c.expected {
+			t.Errorf("%s: expected %s, actual %s", c.expression, c.expected, expanded)
+		}
+	}
+
+	if grok.IsGrok(`x%{2}`) {
+		t.Error("quantifier must not be grok pattern")
+	}
+}
+
+func TestUserPatternsFromFile(t *testing.T) {
+	f, err := ioutil.TempFile("", "als_patterns")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	_, err = f.WriteString("STATUS %{INT}\n")
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	g := grok.New()
+	if _, err = g.Expand(`%{STATUS:status}`); err == nil {
+		t.Error("pattern must be unknown before file is read")
+	}
+
+	if err = g.AddPatternsFromFile(f.Name()); err != nil {
+		t.Fatal(err)
+	}
+
+	expression, err := g.Expand(`%{IPORHOST:client} %{STATUS:status}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	matches := regexp.MustCompile(expression).FindStringSubmatch("10.0.0.1 200")
+	if matches == nil || matches[1] != "10.0.0.1" || matches[2] != "200" {
+		t.Errorf("incorrect matches %v of %s", matches, expression)
+	}
+
+	if err = g.AddPatternsFromFile(f.Name() + ".absent"); err == nil {
+		t.Error("absent patterns file must fail")
+	}
+}
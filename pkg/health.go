@@ -0,0 +1,231 @@
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/blackbass1988/access_logs_stats/pkg/output"
+)
+
+//HealthConfig contains thresholds of /healthz and /readyz. Zero threshold is not checked
+type HealthConfig struct {
+	//LineTimeout is a max time without read lines. It is checked by /healthz
+	LineTimeout time.Duration
+	//SendTimeout is a max time without successful sending of every output. It is checked by /readyz
+	SendTimeout time.Duration
+}
+
+type healthConfigStruct struct {
+	LineTimeout string `json:"line_timeout" yaml:"line_timeout"`
+	SendTimeout string `json:"send_timeout" yaml:"send_timeout"`
+}
+
+func newHealthConfig(c healthConfigStruct) (h HealthConfig, err error) {
+	if c.LineTimeout != "" {
+		if h.LineTimeout, err = time.ParseDuration(c.LineTimeout); err != nil {
+			return h, fmt.Errorf("health.line_timeout: %s", err)
+		}
+	}
+	if c.SendTimeout != "" {
+		if h.SendTimeout, err = time.ParseDuration(c.SendTimeout); err != nil {
+			return h, fmt.Errorf("health.send_timeout: %s", err)
+		}
+	}
+	return h, nil
+}
+
+//outputSends contains time of last successful sending of every output of SenderCollection
+type outputSends struct {
+	//created is used instead of last sending for outputs which haven't sent anything yet
+	created time.Time
+	last    map[string]time.Time
+	m       sync.Mutex
+}
+
+func newOutputSends(outputs []*outputConfig) *outputSends {
+	s := &outputSends{created: time.Now(), last: make(map[string]time.Time)}
+	for _, o := range outputs {
+		s.last[o.Name] = time.Time{}
+	}
+	return s
+}
+
+func (s *outputSends) sent(name string, t time.Time) {
+	s.m.Lock()
+	s.last[name] = t
+	s.m.Unlock()
+}
+
+func (s *outputSends) copy() map[string]time.Time {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	last := make(map[string]time.Time, len(s.last))
+	for name, t := range s.last {
+		last[name] = t
+	}
+	return last
+}
+
+//sendsTarget wraps target of named output and records its successful sendings
+type sendsTarget struct {
+	output.Target
+	name  string
+	sends *outputSends
+}
+
+//Send implements output.Target. Empty pack is not a successful sending, because nothing was sent
+func (t *sendsTarget) Send(messages []*output.Message) error {
+	err := t.Target.Send(messages)
+	if err == nil && len(messages) > 0 {
+		t.sends.sent(t.name, time.Now())
+	}
+	return err
+}
+
+//pipelineStatus is a state of one App reported by /healthz and /readyz
+type pipelineStatus struct {
+	Config         string                `json:"config"`
+	ConfigChecksum string                `json:"config_checksum"`
+	Input          string                `json:"input"`
+	InputOpen      bool                  `json:"input_open"`
+	LastLine       *time.Time            `json:"last_line"`
+	LastSend       map[string]*time.Time `json:"last_send"`
+
+	//Unhealthy contains failed checks of /healthz, NotReady - failed checks of /readyz only
+	Unhealthy []string `json:"unhealthy,omitempty"`
+	NotReady  []string `json:"not_ready,omitempty"`
+}
+
+//pipelineState is a state of App collected for pipelineStatus
+type pipelineState struct {
+	config    *Config
+	inputOpen bool
+	//opened is a time of input opening. It is used instead of last line if no lines were read
+	opened   time.Time
+	lastLine time.Time
+	sends    *outputSends
+}
+
+//newPipelineStatus makes status of pipeline and checks it with thresholds of config
+func newPipelineStatus(state pipelineState, now time.Time) *pipelineStatus {
+	thresholds := state.config.Health
+	status := &pipelineStatus{
+		Config:         state.config.filepath,
+		ConfigChecksum: state.config.Checksum,
+		Input:          state.config.InputDsn,
+		InputOpen:      state.inputOpen,
+		LastSend:       make(map[string]*time.Time),
+	}
+
+	if !state.inputOpen {
+		status.Unhealthy = append(status.Unhealthy, "input is not open")
+	}
+
+	lastLine := state.opened
+	if !state.lastLine.IsZero() {
+		lastLine = state.lastLine
+		status.LastLine = &state.lastLine
+	}
+	if state.inputOpen && thresholds.LineTimeout > 0 && now.Sub(lastLine) > thresholds.LineTimeout {
+		status.Unhealthy = append(status.Unhealthy,
+			fmt.Sprintf("no lines for %s", now.Sub(lastLine).Truncate(time.Second)))
+	}
+
+	for name, t := range state.sends.copy() {
+		lastSend := state.sends.created
+		status.LastSend[name] = nil
+		if !t.IsZero() {
+			lastSend = t
+			status.LastSend[name] = &lastSend
+		}
+
+		if thresholds.SendTimeout > 0 && now.Sub(lastSend) > thresholds.SendTimeout {
+			status.NotReady = append(status.NotReady,
+				fmt.Sprintf("output \"%s\" has not sent for %s", name, now.Sub(lastSend).Truncate(time.Second)))
+		}
+	}
+
+	return status
+}
+
+//health returns current status of App
+func (a *App) health(now time.Time) *pipelineStatus {
+	a.m.RLock()
+	config := a.config
+	state := pipelineState{
+		config: &config,
+		sends:  a.senderCollection.sends,
+	}
+	if a.inputDone != nil {
+		select {
+		case <-a.inputDone:
+		default:
+			state.inputOpen = true
+		}
+	}
+	a.m.RUnlock()
+
+	if t := atomic.LoadInt64(&a.inputOpened); t != 0 {
+		state.opened = time.Unix(0, t)
+	}
+	if t := atomic.LoadInt64(&a.lastLine); t != 0 {
+		state.lastLine = time.Unix(0, t)
+	}
+
+	return newPipelineStatus(state, now)
+}
+
+//apps are started Apps reported by /healthz and /readyz
+var apps = struct {
+	list []*App
+	m    sync.Mutex
+}{}
+
+func registerApp(a *App) {
+	apps.m.Lock()
+	apps.list = append(apps.list, a)
+	apps.m.Unlock()
+}
+
+//healthResponse is a body of /healthz and /readyz
+type healthResponse struct {
+	Status    string            `json:"status"`
+	Pipelines []*pipelineStatus `json:"pipelines"`
+}
+
+//healthHandler serves /healthz if ready is false and /readyz otherwise.
+//Status is 503 if any check is failed
+func healthHandler(ready bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		now := time.Now()
+		response := healthResponse{Status: "ok", Pipelines: []*pipelineStatus{}}
+		code := http.StatusOK
+
+		apps.m.Lock()
+		list := apps.list
+		apps.m.Unlock()
+
+		if ready && len(list) == 0 {
+			response.Status = "not started"
+			code = http.StatusServiceUnavailable
+		}
+
+		for _, a := range list {
+			status := a.health(now)
+			if len(status.Unhealthy) > 0 || ready && len(status.NotReady) > 0 {
+				response.Status = "fail"
+				code = http.StatusServiceUnavailable
+			}
+			response.Pipelines = append(response.Pipelines, status)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(response)
+	}
+}
@@ -0,0 +1,74 @@
+package pkg
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/blackbass1988/access_logs_stats/pkg/output"
+)
+
+type failingTarget struct{}
+
+func (f *failingTarget) Send(messages []*output.Message) error {
+	return errors.New("connection refused")
+}
+
+func TestPipelineStatus(t *testing.T) {
+	now := time.Now()
+	config := &Config{
+		InputDsn: "file:/var/log/nginx/access.log",
+		Checksum: "abc",
+		Outputs:  []*outputConfig{{Name: "graphite"}, {Name: "zabbix"}},
+		Health:   HealthConfig{LineTimeout: time.Minute, SendTimeout: 5 * time.Minute},
+	}
+
+	sends := newOutputSends(config.Outputs)
+	sends.created = now.Add(-10 * time.Minute)
+	messages := []*output.Message{{Field: "code", Metric: "cps_200", Value: "1.000"}}
+	(&sendsTarget{new(fakeTarget), "graphite", sends}).Send(messages)
+	(&sendsTarget{new(failingTarget), "zabbix", sends}).Send(messages)
+	//empty pack is not a successful sending
+	(&sendsTarget{new(fakeTarget), "zabbix", sends}).Send(nil)
+
+	state := pipelineState{
+		config:    config,
+		inputOpen: true,
+		opened:    now.Add(-10 * time.Minute),
+		lastLine:  now.Add(-10 * time.Second),
+		sends:     sends,
+	}
+
+	status := newPipelineStatus(state, now)
+	if len(status.Unhealthy) != 0 {
+		t.Errorf("unexpected unhealthy checks %v", status.Unhealthy)
+	}
+	if len(status.NotReady) != 1 || status.NotReady[0] != "output \"zabbix\" has not sent for 10m0s" {
+		t.Errorf("unexpected not ready checks %v", status.NotReady)
+	}
+	if status.LastSend["graphite"] == nil || status.LastSend["zabbix"] != nil {
+		t.Errorf("unexpected last sends %v", status.LastSend)
+	}
+	if status.ConfigChecksum != "abc" || status.LastLine == nil {
+		t.Errorf("unexpected status %+v", status)
+	}
+
+	state.lastLine = time.Time{}
+	status = newPipelineStatus(state, now)
+	if len(status.Unhealthy) != 1 || status.Unhealthy[0] != "no lines for 10m0s" {
+		t.Errorf("unexpected unhealthy checks %v", status.Unhealthy)
+	}
+
+	state.inputOpen = false
+	status = newPipelineStatus(state, now)
+	if len(status.Unhealthy) != 1 || status.Unhealthy[0] != "input is not open" {
+		t.Errorf("unexpected unhealthy checks %v", status.Unhealthy)
+	}
+
+	config.Health = HealthConfig{}
+	state.inputOpen = true
+	status = newPipelineStatus(state, now)
+	if len(status.Unhealthy) != 0 || len(status.NotReady) != 0 {
+		t.Errorf("thresholds are not set, but checks failed: %v %v", status.Unhealthy, status.NotReady)
+	}
+}
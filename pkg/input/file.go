@@ -2,6 +2,7 @@ package input
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -11,7 +12,17 @@ import (
 	"time"
 )
 
-//FileInputReader is a BufferedReader for a file reading
+//checkInterval is an interval of checking file for rotation if watcher misses events, e.g. on network filesystems.
+//Rotated file is read until it is not written for checkInterval. It is a variable for tests
+var checkInterval = 10 * time.Second
+
+//maxRotationGrace is a max time of reading rotated file which is still written
+const maxRotationGrace = time.Minute
+
+var errReaderClosed = errors.New("reader is closed")
+
+//FileInputReader is a BufferedReader for a file reading.
+//Reading is woken by watcher: inotify on linux or polling on other systems and if inotify is not available
 type FileInputReader struct {
 	BufferedReader
 
@@ -19,78 +30,349 @@ type FileInputReader struct {
 	fi   os.FileInfo
 
 	fileReader *bufio.Reader
+	//partial is a beginning of line which is not written completely yet
+	partial []byte
+
+	//offset is a position in file after the last read line. It is sent with every line
+	offset int64
+
+	//checkpointed is a position saved to stateFile by last Checkpoint
+	checkpointed Position
+	stateFile    string
+
+	//rotation is a state of reading of rotated file. It is zero if new file is not found yet
+	rotation rotation
+	//leaving is true if file doesn't match glob anymore. It is read like rotated file and closed then
+	leaving bool
+	//globbed is true for readers of GlobInputReader. They don't reopen rotated file: glob reader makes them leave
+	//and opens new file itself
+	globbed bool
 
-	m sync.Mutex
+	watcher watcher
+
+	closed bool
+	done   chan struct{}
+	m      sync.Mutex
 }
 
-//CreateFileReader create new FileInputReader
+//CreateFileReader create new FileInputReader. It reads from the end of file until Resume is called
 func CreateFileReader(dsn string) (r *FileInputReader, err error) {
-	filename := strings.Replace(dsn, "file:", "", 1)
+	return newFileReader(strings.Replace(dsn, "file:", "", 1), io.SeekEnd)
+}
+
+//newFileReader opens file and seeks to its beginning or end by whence
+func newFileReader(filename string, whence int) (r *FileInputReader, err error) {
+	r = &FileInputReader{done: make(chan struct{})}
+	if err = r.openFile(filename); err != nil {
+		return nil, err
+	}
+	r.offset, err = r.file.Seek(0, whence)
+	if err != nil {
+		r.file.Close()
+		return nil, err
+	}
+	r.checkpointed = r.position()
+
+	r.watcher, err = newWatcher(filename)
+	if err != nil {
+		log.Printf("can't watch %s, polling it instead. error was: %s\n", filename, err)
+		r.watcher = newPollWatcher()
+	}
+
+	return r, nil
+}
+
+//Resume implements Checkpointer. File is read from saved offset if it is the same file and it is not truncated,
+//from the beginning if file was rotated or truncated since state was saved and from the end if there is no state
+func (r *FileInputReader) Resume(stateFile string) error {
+	state := new(Position)
+	found, err := readState(stateFile, state)
+	if err != nil {
+		return fmt.Errorf("input state \"%s\": %s", stateFile, err)
+	}
+
+	r.m.Lock()
+	defer r.m.Unlock()
 
-	r = &FileInputReader{}
-	r.openFile(filename)
-	r.file.Seek(0, 2)
-	go r.checkFile()
+	r.stateFile = stateFile
+	if !found || state.File != r.file.Name() {
+		log.Printf("no input state of %s, reading from the end of file\n", r.file.Name())
+		return nil
+	}
+	return r.seekState(*state)
+}
+
+//seekState seeks to offset of state. r.m must be locked
+func (r *FileInputReader) seekState(state Position) error {
+	offset := state.Offset
+	if inode(r.fi) != state.Inode {
+		log.Printf("%s was rotated since state was saved, reading from the beginning of file\n", r.file.Name())
+		offset = 0
+	} else if r.fi.Size() < state.Offset {
+		log.Printf("%s was truncated since state was saved, reading from the beginning of file\n", r.file.Name())
+		offset = 0
+	}
+	return r.seek(offset)
+}
 
-	return r, err
+//seek sets position of reading. r.m must be locked
+func (r *FileInputReader) seek(offset int64) error {
+	if _, err := r.file.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	r.fileReader.Reset(r.file)
+	r.partial = nil
+	r.offset = offset
+	r.checkpointed = r.position()
+	log.Printf("reading %s from offset %d\n", r.file.Name(), offset)
+	return nil
+}
+
+//Checkpoint implements Checkpointer. It does nothing if state file is not set by Resume
+func (r *FileInputReader) Checkpoint(positions []Position) error {
+	r.m.Lock()
+	stateFile := r.stateFile
+	r.m.Unlock()
+
+	if stateFile == "" {
+		return nil
+	}
+	return writeState(stateFile, r.checkpoint(positions))
+}
+
+//checkpoint updates position to save with position of file from positions and returns it
+func (r *FileInputReader) checkpoint(positions []Position) Position {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	for _, p := range positions {
+		if p.File == r.checkpointed.File {
+			r.checkpointed = p
+		}
+	}
+	return r.checkpointed
+}
+
+//fileID identifies file by device and inode. It is zero if system doesn't provide them
+type fileID struct {
+	dev uint64
+	ino uint64
+}
+
+//readTo returns id of file and offset after the last read line
+func (r *FileInputReader) readTo() (fileID, int64) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	return getFileID(r.fi), r.offset
+}
+
+//position returns position after the last read line. r.m must be locked
+func (r *FileInputReader) position() Position {
+	return Position{File: r.file.Name(), Inode: inode(r.fi), Offset: r.offset}
 }
 
 //Close implements Close method of BufferedReader for FileInputReader
 func (r *FileInputReader) Close() {
-	r.file.Close()
+	r.m.Lock()
+	if !r.closed {
+		r.closed = true
+		close(r.done)
+		r.watcher.Close()
+		r.file.Close()
+	}
+	r.m.Unlock()
 }
 
-//ReadToChannel read bytes and save to lineChannel as string
-func (r *FileInputReader) ReadToChannel(lineChannel chan<- string) {
-	log.Println("reading...")
+//ReadToChannel read bytes and save to lineChannel as string. lineChannel is closed after Close
+func (r *FileInputReader) ReadToChannel(lineChannel chan<- Line) {
+	defer close(lineChannel)
+
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+
+	log.Printf("reading %s...\n", r.file.Name())
 	for {
-		r.m.Lock()
-		bytesBuf, err := r.fileReader.ReadBytes('\n')
-		r.m.Unlock()
+		line, err := r.readLine()
+		if err == errReaderClosed {
+			return
+		}
 		if err == io.EOF {
-			time.Sleep(10 * time.Millisecond)
+			select {
+			case <-r.done:
+				return
+			case <-r.watcher.Events():
+			case <-ticker.C:
+			}
+			r.checkFile(lineChannel)
 			continue
-		} else if err != nil {
-			check(err)
 		}
-		lineChannel <- string(bytesBuf)
+		check(err)
+
+		lineChannel <- line
 	}
 }
 
-func (r *FileInputReader) openFile(filename string) {
-	var err error
+//readLine returns next complete line. Beginning of incomplete line is kept until the rest of it is written
+func (r *FileInputReader) readLine() (Line, error) {
+	r.m.Lock()
+	defer r.m.Unlock()
 
-	r.file, err = os.Open(filename)
-	r.fi, err = r.file.Stat()
-	if err != nil && !os.IsExist(err) {
-		err = fmt.Errorf("file \"%s\" not exists", filename)
+	if r.closed {
+		return Line{}, errReaderClosed
 	}
+
+	bytesBuf, err := r.fileReader.ReadBytes('\n')
+	if err != nil {
+		r.partial = append(r.partial, bytesBuf...)
+		return Line{}, err
+	}
+
+	if len(r.partial) > 0 {
+		bytesBuf = append(r.partial, bytesBuf...)
+		r.partial = nil
+	}
+	r.offset += int64(len(bytesBuf))
+	return Line{Text: string(bytesBuf), Position: r.position()}, nil
+}
+
+func (r *FileInputReader) openFile(filename string) (err error) {
+	file, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("file \"%s\" not exists", filename)
+	}
+	if err != nil {
+		return err
+	}
+
+	r.fi, err = file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	r.file = file
 	r.fileReader = bufio.NewReader(r.file)
-	check(err)
+	r.partial = nil
+	return nil
 }
 
-func (r *FileInputReader) checkFile() {
-	var prevSize int64
-	prevSize = -1
-	tick1s := time.Tick(1 * time.Second)
-	for {
-		select {
-		case <-tick1s:
-			fi, err := os.Stat(r.file.Name())
-			check(err)
+//rotation is a state of rotated file which is read until writer reopens file
+type rotation struct {
+	//found is a time when new file was found
+	found time.Time
+	//written is a time when rotated file was written last time, size is its size then
+	written time.Time
+	size    int64
+}
 
-			if prevSize == -1 {
-				prevSize = fi.Size()
-			}
+//checkFile reopens file if it was rotated and reads it from the beginning if it was truncated.
+//Rotated file is reopened when writer stops writing to it, e.g. nginx does it only after signal of postrotate
+func (r *FileInputReader) checkFile(lineChannel chan<- Line) {
+	r.m.Lock()
+	filename := r.file.Name()
+	leaving, globbed := r.leaving, r.globbed
+	r.m.Unlock()
+
+	if leaving {
+		if r.rotationDone(time.Now()) {
+			r.drain(lineChannel)
+			r.Close()
+		}
+		return
+	}
+
+	fi, err := os.Stat(filename)
+	if os.IsNotExist(err) {
+		//file is renamed by rotation and new one is not created yet. Old one is read until then
+		return
+	}
+	check(err)
+
+	r.m.Lock()
+	rotated := !os.SameFile(fi, r.fi)
+	truncated := !rotated && fi.Size() < r.offset+int64(len(r.partial))
+	r.m.Unlock()
 
-			if !os.SameFile(fi, r.fi) || prevSize > fi.Size() {
-				log.Println("reopen input file")
-				r.m.Lock()
-				r.file.Close()
-				r.openFile(r.file.Name())
-				r.m.Unlock()
+	switch {
+	case truncated:
+		log.Printf("%s was truncated\n", filename)
+		r.m.Lock()
+		if !r.closed {
+			check(r.seek(0))
+		}
+		r.m.Unlock()
+	case rotated && globbed:
+		return
+	case rotated:
+		if !r.rotationDone(time.Now()) {
+			return
+		}
+
+		//lines written to old file before writer reopened it are read before switching to new one
+		r.drain(lineChannel)
+
+		log.Println("reopen input file")
+		r.m.Lock()
+		if !r.closed {
+			r.file.Close()
+			check(r.openFile(filename))
+			r.offset = 0
+			r.rotation = rotation{}
+			if err = r.watcher.Rewatch(); err != nil {
+				log.Printf("can't watch %s again: %s\n", filename, err)
 			}
-			prevSize = fi.Size()
 		}
+		r.m.Unlock()
+	}
+}
+
+//leave makes reader finish reading of file which doesn't match glob anymore, e.g. renamed by rotation.
+//File is read until it is not written like rotated file, then the rest of it is sent and reader is closed
+func (r *FileInputReader) leave() {
+	r.m.Lock()
+	r.leaving = true
+	r.m.Unlock()
+}
+
+//rotationDone returns true if rotated file is not written for checkInterval or it is read for maxRotationGrace
+func (r *FileInputReader) rotationDone(now time.Time) bool {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	size := r.offset + int64(len(r.partial))
+	if r.rotation.found.IsZero() {
+		log.Printf("%s was rotated, reading it until it is not written for %s\n", r.file.Name(), checkInterval)
+		r.rotation = rotation{found: now, written: now, size: size}
+		return false
+	}
+
+	if size != r.rotation.size {
+		r.rotation.written = now
+		r.rotation.size = size
+	}
+	return now.Sub(r.rotation.written) >= checkInterval || now.Sub(r.rotation.found) >= maxRotationGrace
+}
+
+//drain sends the rest of lines of rotated file. Incomplete last line is sent too because file won't be written anymore
+func (r *FileInputReader) drain(lineChannel chan<- Line) {
+	for {
+		line, err := r.readLine()
+		if err == errReaderClosed {
+			return
+		}
+		if err == io.EOF {
+			break
+		}
+		check(err)
+		lineChannel <- line
+	}
+
+	r.m.Lock()
+	r.offset += int64(len(r.partial))
+	line := Line{Text: string(r.partial), Position: r.position()}
+	r.partial = nil
+	r.m.Unlock()
+
+	if line.Text != "" {
+		lineChannel <- line
 	}
 }
@@ -0,0 +1,158 @@
+package input
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+//readFile reads count lines of reader started with ReadToChannel
+func readFile(t *testing.T, lineChannel <-chan Line, count int) []string {
+	t.Helper()
+
+	var lines []string
+	timeout := time.After(5 * time.Second)
+	for len(lines) < count {
+		select {
+		case line := <-lineChannel:
+			lines = append(lines, line.Text)
+		case <-timeout:
+			t.Fatalf("expected %d lines, got %q", count, lines)
+		}
+	}
+	return lines
+}
+
+func TestFilePartialLine(t *testing.T) {
+	dir, err := ioutil.TempDir("", "als_file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "access.log")
+	appendToFile(t, path, "")
+
+	r, err := CreateFileReader("file:" + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	lineChannel := make(chan Line, 10)
+	go r.ReadToChannel(lineChannel)
+
+	appendToFile(t, path, "first\nsec")
+	time.Sleep(100 * time.Millisecond)
+	appendToFile(t, path, "ond\n")
+
+	checkLines(t, readFile(t, lineChannel, 2), "first\n", "second\n")
+	r.m.Lock()
+	offset := r.offset
+	r.m.Unlock()
+	if offset != int64(len("first\nsecond\n")) {
+		t.Errorf("unexpected offset %d", offset)
+	}
+}
+
+//setCheckInterval shortens checkInterval for test. Returned func restores it
+func setCheckInterval(d time.Duration) func() {
+	prev := checkInterval
+	checkInterval = d
+	return func() { checkInterval = prev }
+}
+
+func TestFileRotation(t *testing.T) {
+	defer setCheckInterval(500 * time.Millisecond)()
+
+	dir, err := ioutil.TempDir("", "als_file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "access.log")
+	appendToFile(t, path, "")
+
+	r, err := CreateFileReader("file:" + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	lineChannel := make(chan Line, 10)
+	go r.ReadToChannel(lineChannel)
+
+	//writer keeps old file open after rename and writes to it until it reopens file
+	writer, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = writer.WriteString("before rotation\n"); err != nil {
+		t.Fatal(err)
+	}
+	checkLines(t, readFile(t, lineChannel, 1), "before rotation\n")
+
+	if err = os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = writer.WriteString("after rename\n"); err != nil {
+		t.Fatal(err)
+	}
+	checkLines(t, readFile(t, lineChannel, 1), "after rename\n")
+
+	//logrotate "create" makes new file, but writer writes to old one until it is signalled
+	appendToFile(t, path, "new file\n")
+	time.Sleep(100 * time.Millisecond)
+	if _, err = writer.WriteString("after create\nincomplete"); err != nil {
+		t.Fatal(err)
+	}
+	writer.Close()
+
+	checkLines(t, readFile(t, lineChannel, 3), "after create\n", "incomplete", "new file\n")
+}
+
+func TestFileTruncation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "als_file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "access.log")
+	appendToFile(t, path, "")
+
+	r, err := CreateFileReader("file:" + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	lineChannel := make(chan Line, 10)
+	go r.ReadToChannel(lineChannel)
+
+	appendToFile(t, path, "before truncation\n")
+	checkLines(t, readFile(t, lineChannel, 1), "before truncation\n")
+
+	//copytruncate
+	if err = os.Truncate(path, 0); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	appendToFile(t, path, "short\n")
+
+	checkLines(t, readFile(t, lineChannel, 1), "short\n")
+}
+
+func TestPollWatcher(t *testing.T) {
+	w := newPollWatcher()
+	defer w.Close()
+
+	select {
+	case <-w.Events():
+	case <-time.After(5 * pollInterval):
+		t.Fatal("poll watcher doesn't report changes")
+	}
+}
@@ -0,0 +1,310 @@
+package input
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+//isGlob returns true if dsn contains glob pattern
+func isGlob(dsn string) bool {
+	return strings.ContainsAny(dsn, "*?[")
+}
+
+//GlobInputReader is a BufferedReader which tails all files matched by glob pattern.
+//Pattern is matched again every second: new files are read from the beginning and files
+//which don't match anymore are read until they are not written and closed then.
+//Files are recognized by device and inode, so file renamed to other matched name, e.g. access.log -> access.log.1
+//of access.log*, is not read again: it is read further by the same reader until it is not written
+//and then by new reader from the offset where previous one stopped
+type GlobInputReader struct {
+	BufferedReader
+
+	pattern string
+	readers map[string]*FileInputReader
+	//leaving are readers of files which don't match anymore. They are removed when reading is finished
+	leaving map[*FileInputReader]bool
+	//offsets are positions where leaving readers finished reading. They are kept while files match pattern
+	offsets map[fileID]int64
+
+	//lineChannel is set by ReadToChannel. Lines of every file are forwarded to it
+	lineChannel chan<- Line
+	forwarding  sync.WaitGroup
+
+	stateFile string
+
+	done      chan struct{}
+	closeOnce sync.Once
+	m         sync.Mutex
+}
+
+//CreateGlobReader creates GlobInputReader of "file:" dsn with glob pattern.
+//Files which exist already are read from the end until Resume is called
+func CreateGlobReader(dsn string) (r *GlobInputReader, err error) {
+	pattern := strings.Replace(dsn, "file:", "", 1)
+	if _, err = filepath.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid glob pattern \"%s\": %s", pattern, err)
+	}
+
+	r = &GlobInputReader{
+		pattern: pattern,
+		readers: make(map[string]*FileInputReader),
+		leaving: make(map[*FileInputReader]bool),
+		offsets: make(map[fileID]int64),
+		done:    make(chan struct{}),
+	}
+
+	files, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, filename := range files {
+		fr, err := newFileReader(filename, io.SeekEnd)
+		if err != nil {
+			r.closeReaders()
+			return nil, err
+		}
+		fr.globbed = true
+		r.readers[filename] = fr
+	}
+
+	if len(files) == 0 {
+		log.Printf("no files match %s yet\n", pattern)
+	}
+	return r, nil
+}
+
+//ReadToChannel implements BufferedReader. lineChannel is closed after Close when lines of all files are sent
+func (r *GlobInputReader) ReadToChannel(lineChannel chan<- Line) {
+	r.m.Lock()
+	r.lineChannel = lineChannel
+	for _, fr := range r.readers {
+		r.forward(fr)
+	}
+	r.m.Unlock()
+
+	ticker := time.NewTicker(1 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			r.rescan()
+		case <-r.done:
+			r.m.Lock()
+			r.closeReaders()
+			r.m.Unlock()
+
+			r.forwarding.Wait()
+			close(lineChannel)
+			return
+		}
+	}
+}
+
+//forward starts reading of file to lineChannel. r.m must be locked
+func (r *GlobInputReader) forward(fr *FileInputReader) {
+	fileChannel := make(chan Line)
+	go fr.ReadToChannel(fileChannel)
+
+	r.forwarding.Add(1)
+	go func() {
+		defer r.forwarding.Done()
+		for line := range fileChannel {
+			r.lineChannel <- line
+		}
+
+		id, offset := fr.readTo()
+		r.m.Lock()
+		delete(r.leaving, fr)
+		if id != (fileID{}) {
+			r.offsets[id] = offset
+		}
+		r.m.Unlock()
+	}()
+}
+
+//rescan opens new files matched by pattern and finishes reading of files which don't match anymore.
+//Reader of file which was replaced by other file with the same name is finished too, e.g. on rotation
+func (r *GlobInputReader) rescan() {
+	files, err := filepath.Glob(r.pattern)
+	if err != nil {
+		log.Println("glob error:", err)
+		return
+	}
+
+	ids := make(map[string]fileID, len(files))
+	for _, filename := range files {
+		//file can be removed since glob, it is not an error
+		if fi, err := os.Stat(filename); err == nil {
+			ids[filename] = getFileID(fi)
+		}
+	}
+
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	for filename, fr := range r.readers {
+		id, ok := ids[filename]
+		if !ok {
+			log.Printf("%s doesn't match %s anymore, reading the rest of it\n", filename, r.pattern)
+		} else if readID, _ := fr.readTo(); id != readID {
+			log.Printf("%s was replaced by other file, reading the rest of previous one\n", filename)
+		} else {
+			continue
+		}
+		fr.leave()
+		delete(r.readers, filename)
+		r.leaving[fr] = true
+	}
+
+	reading := make(map[fileID]bool)
+	for _, fr := range r.readers {
+		id, _ := fr.readTo()
+		reading[id] = true
+	}
+	for fr := range r.leaving {
+		id, _ := fr.readTo()
+		reading[id] = true
+	}
+
+	for _, filename := range files {
+		id, ok := ids[filename]
+		if _, exists := r.readers[filename]; exists || !ok {
+			continue
+		}
+		if id != (fileID{}) && reading[id] {
+			//file is renamed and it is still read by reader of previous name
+			continue
+		}
+
+		fr, err := r.openFile(filename, id)
+		if err != nil {
+			log.Println("input file open error:", err)
+			continue
+		}
+		r.readers[filename] = fr
+		r.forward(fr)
+	}
+
+	matchedIDs := make(map[fileID]bool, len(ids))
+	for _, id := range ids {
+		matchedIDs[id] = true
+	}
+	for id := range r.offsets {
+		if !matchedIDs[id] {
+			delete(r.offsets, id)
+		}
+	}
+}
+
+//openFile opens new file matched by pattern. File which was read under other name is read from the offset
+//where previous reader finished, other files are read from the beginning. r.m must be locked
+func (r *GlobInputReader) openFile(filename string, id fileID) (*FileInputReader, error) {
+	fr, err := newFileReader(filename, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+	fr.globbed = true
+
+	offset, ok := r.offsets[id]
+	if !ok || id == (fileID{}) {
+		log.Printf("new file %s matches %s\n", filename, r.pattern)
+		return fr, nil
+	}
+
+	log.Printf("%s was read under other name, reading it further\n", filename)
+	fr.m.Lock()
+	if getFileID(fr.fi) == id && fr.fi.Size() >= offset {
+		err = fr.seek(offset)
+	}
+	fr.m.Unlock()
+
+	if err != nil {
+		fr.Close()
+		return nil, err
+	}
+	return fr, nil
+}
+
+//Resume implements Checkpointer. Files from state are resumed like FileInputReader does it.
+//Files which are absent in existing state were created since state was saved, so they are read from the beginning
+func (r *GlobInputReader) Resume(stateFile string) error {
+	var states []Position
+	found, err := readState(stateFile, &states)
+	if err != nil {
+		return fmt.Errorf("input state \"%s\": %s", stateFile, err)
+	}
+
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	r.stateFile = stateFile
+	if !found {
+		log.Printf("no input state of %s, reading from the end of files\n", r.pattern)
+		return nil
+	}
+
+	byFile := make(map[string]Position, len(states))
+	for _, state := range states {
+		byFile[state.File] = state
+	}
+
+	for filename, fr := range r.readers {
+		fr.m.Lock()
+		if state, ok := byFile[filename]; ok {
+			err = fr.seekState(state)
+		} else {
+			log.Printf("%s was created since state was saved, reading from the beginning of file\n", filename)
+			err = fr.seek(0)
+		}
+		fr.m.Unlock()
+
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//Checkpoint implements Checkpointer. It saves state of every file. It does nothing if state file is not set by Resume
+func (r *GlobInputReader) Checkpoint(positions []Position) error {
+	r.m.Lock()
+	stateFile := r.stateFile
+	states := []Position{}
+	for _, fr := range r.readers {
+		states = append(states, fr.checkpoint(positions))
+	}
+	r.m.Unlock()
+
+	if stateFile == "" {
+		return nil
+	}
+
+	sort.Slice(states, func(i, j int) bool { return states[i].File < states[j].File })
+	return writeState(stateFile, states)
+}
+
+//Close implements BufferedReader
+func (r *GlobInputReader) Close() {
+	r.closeOnce.Do(func() {
+		close(r.done)
+	})
+}
+
+//closeReaders closes readers of all files. r.m must be locked
+func (r *GlobInputReader) closeReaders() {
+	for _, fr := range r.readers {
+		fr.Close()
+	}
+	for fr := range r.leaving {
+		fr.Close()
+	}
+}
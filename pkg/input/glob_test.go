@@ -0,0 +1,200 @@
+package input
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestGlobReader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "als_glob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	a := filepath.Join(dir, "a.access.log")
+	b := filepath.Join(dir, "b.access.log")
+	c := filepath.Join(dir, "c.access.log")
+	stateFile := filepath.Join(dir, "access.state")
+	appendToFile(t, a, "a old\n")
+	appendToFile(t, b, "b old\n")
+	appendToFile(t, filepath.Join(dir, "other.log"), "other\n")
+
+	pattern := "file:" + filepath.Join(dir, "*.access.log")
+	r, err := CreateGlobReader(pattern)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//existing files are read from the end, new ones - from the beginning
+	appendToFile(t, a, "a new\n")
+	appendToFile(t, c, "c new\n")
+	checkGlobLines(t, readLines(t, r, stateFile, 2), a+": a new\n", c+": c new\n")
+
+	//files written and created while reader was stopped are read from saved offsets
+	appendToFile(t, b, "b down\n")
+	appendToFile(t, c, "c down\n")
+	d := filepath.Join(dir, "d.access.log")
+	appendToFile(t, d, "d down\n")
+
+	r, err = CreateGlobReader(pattern)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkGlobLines(t, readLines(t, r, stateFile, 3), b+": b down\n", c+": c down\n", d+": d down\n")
+}
+
+func TestGlobLeavingFiles(t *testing.T) {
+	defer setCheckInterval(500 * time.Millisecond)()
+
+	dir, err := ioutil.TempDir("", "als_glob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	a := filepath.Join(dir, "a.access.log")
+	b := filepath.Join(dir, "b.access.log")
+	stateFile := filepath.Join(dir, "access.state")
+	appendToFile(t, a, "")
+	appendToFile(t, b, "")
+
+	r, err := CreateGlobReader("file:" + filepath.Join(dir, "*.access.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if err = r.Resume(stateFile); err != nil {
+		t.Fatal(err)
+	}
+
+	lineChannel := make(chan Line, 10)
+	go r.ReadToChannel(lineChannel)
+
+	//writer keeps renamed file open and writes to it after it doesn't match anymore
+	writer, err := os.OpenFile(a, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer writer.Close()
+	if err = os.Rename(a, a+".1"); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Remove(b); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(1500 * time.Millisecond)
+	if _, err = writer.WriteString("after rename\nincomplete"); err != nil {
+		t.Fatal(err)
+	}
+
+	checkLines(t, readFile(t, lineChannel, 2), "after rename\n", "incomplete")
+
+	//renamed and deleted files are dropped when they are read completely
+	for start := time.Now(); ; time.Sleep(50 * time.Millisecond) {
+		r.m.Lock()
+		left := len(r.readers) + len(r.leaving)
+		r.m.Unlock()
+		if left == 0 {
+			break
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("%d readers are not dropped", left)
+		}
+	}
+
+	if err = r.Checkpoint(nil); err != nil {
+		t.Fatal(err)
+	}
+	var states []Position
+	if _, err = readState(stateFile, &states); err != nil {
+		t.Fatal(err)
+	}
+	if len(states) != 0 {
+		t.Errorf("dropped files must not be in state, actual %+v", states)
+	}
+}
+
+func TestGlobRotation(t *testing.T) {
+	defer setCheckInterval(500 * time.Millisecond)()
+
+	dir, err := ioutil.TempDir("", "als_glob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "access.log")
+	appendToFile(t, path, "")
+
+	r, err := CreateGlobReader("file:" + path + "*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	lineChannel := make(chan Line, 10)
+	go r.ReadToChannel(lineChannel)
+
+	writer, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer writer.Close()
+	if _, err = writer.WriteString("old 1\n"); err != nil {
+		t.Fatal(err)
+	}
+	checkLines(t, readFile(t, lineChannel, 1), "old 1\n")
+
+	//rotated file still matches pattern, it is read further and not from the beginning
+	if err = os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	appendToFile(t, path, "new 1\n")
+	if _, err = writer.WriteString("old 2\n"); err != nil {
+		t.Fatal(err)
+	}
+	lines := readFile(t, lineChannel, 2)
+	sort.Strings(lines)
+	checkLines(t, lines, "new 1\n", "old 2\n")
+
+	//writer which keeps rotated file open after the first reader is finished
+	time.Sleep(3 * time.Second)
+	if _, err = writer.WriteString("old 3\n"); err != nil {
+		t.Fatal(err)
+	}
+	checkLines(t, readFile(t, lineChannel, 1), "old 3\n")
+
+	select {
+	case line := <-lineChannel:
+		t.Errorf("unexpected line %+v", line)
+	case <-time.After(1500 * time.Millisecond):
+	}
+}
+
+func checkGlobLines(t *testing.T, lines []Line, expected ...string) {
+	t.Helper()
+	var got []string
+	for _, line := range lines {
+		got = append(got, line.File+": "+line.Text)
+	}
+	sort.Strings(got)
+	checkLines(t, got, expected...)
+}
+
+func TestIsGlob(t *testing.T) {
+	for dsn, expected := range map[string]bool{
+		"file:/var/log/nginx/access.log":   false,
+		"file:/var/log/nginx/*.access.log": true,
+		"file:/var/log/nginx/access.log.?": true,
+		"file:/var/log/[ab].log":           true,
+	} {
+		if isGlob(dsn) != expected {
+			t.Errorf("isGlob(%s) must be %v", dsn, expected)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+//+build !windows
+
+package input
+
+import (
+	"os"
+	"syscall"
+)
+
+//inode returns inode of file. It is used to detect rotation between restarts
+func inode(fi os.FileInfo) uint64 {
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		return uint64(st.Ino)
+	}
+	return 0
+}
+
+//getFileID returns device and inode of file
+func getFileID(fi os.FileInfo) fileID {
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		return fileID{dev: uint64(st.Dev), ino: uint64(st.Ino)}
+	}
+	return fileID{}
+}
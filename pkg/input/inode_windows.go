@@ -0,0 +1,13 @@
+package input
+
+import "os"
+
+//inode is not available on windows, so rotation between restarts is detected by size only
+func inode(fi os.FileInfo) uint64 {
+	return 0
+}
+
+//getFileID returns zero id on windows, so renamed files are not recognized by glob reader
+func getFileID(fi os.FileInfo) fileID {
+	return fileID{}
+}
@@ -6,9 +6,16 @@ import (
 	"strings"
 )
 
+//Line is a line read from input
+type Line struct {
+	Text string
+	//Position is a position in file after the line. It is empty for inputs other than file
+	Position
+}
+
 //BufferedReader describes interface of implementations
 type BufferedReader interface {
-	ReadToChannel(lineChannel chan<- string)
+	ReadToChannel(lineChannel chan<- Line)
 	Close()
 }
 
@@ -24,7 +31,9 @@ func GetFileReader(inputDsn string) (BufferedReader, error) {
 	var err error
 	var r BufferedReader
 
-	if strings.HasPrefix(inputDsn, "file:") {
+	if strings.HasPrefix(inputDsn, "file:") && isGlob(inputDsn) {
+		r, err = CreateGlobReader(inputDsn)
+	} else if strings.HasPrefix(inputDsn, "file:") {
 		r, err = CreateFileReader(inputDsn)
 	} else if strings.HasPrefix(inputDsn, "syslog:") {
 		r, err = CreateSyslogInputReader(inputDsn)
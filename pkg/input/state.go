@@ -0,0 +1,66 @@
+package input
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+//Checkpointer is implemented by inputs which can save position of read lines to state file
+//and continue reading from it after restart
+type Checkpointer interface {
+	//Resume sets state file and seeks to position saved in it. It must be called before ReadToChannel
+	Resume(stateFile string) error
+	//Checkpoint saves positions to state file. positions are positions of the last lines handled by app,
+	//so lines which are read but not handled yet are read again after restart.
+	//Files without position keep position saved before
+	Checkpoint(positions []Position) error
+}
+
+//Position is a position in file after a line. It is a content of state file of file input
+type Position struct {
+	//File is a path of file which line was read from
+	File   string `json:"file"`
+	Inode  uint64 `json:"inode"`
+	Offset int64  `json:"offset"`
+}
+
+//readState reads state file into state. It returns false if state file doesn't exist
+func readState(path string, state interface{}) (bool, error) {
+	bytes, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, json.Unmarshal(bytes, state)
+}
+
+//writeState replaces state file atomically, so it is never left half written
+func writeState(path string, state interface{}) error {
+	bytes, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+
+	if _, err = tmp.Write(bytes); err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
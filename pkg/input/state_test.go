@@ -0,0 +1,209 @@
+package input
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func appendToFile(t *testing.T, path string, content string) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err = f.WriteString(content); err != nil {
+		t.Fatal(err)
+	}
+}
+
+//appendLater appends content to file after reader is started. It runs in other goroutine,
+//so it reports error with t.Error: t.Fatal can't be called there
+func appendLater(t *testing.T, path string, content string) {
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+		if err == nil {
+			_, err = f.WriteString(content)
+			f.Close()
+		}
+		if err != nil {
+			t.Error(err)
+		}
+	}()
+}
+
+type checkpointedReader interface {
+	BufferedReader
+	Checkpointer
+}
+
+//readLines resumes reading of input with state, reads count lines and saves positions of them
+func readLines(t *testing.T, r checkpointedReader, stateFile string, count int) []Line {
+	if err := r.Resume(stateFile); err != nil {
+		t.Fatal(err)
+	}
+
+	lineChannel := make(chan Line, count)
+	go r.ReadToChannel(lineChannel)
+
+	var lines []Line
+	timeout := time.After(5 * time.Second)
+	for len(lines) < count {
+		select {
+		case line := <-lineChannel:
+			lines = append(lines, line)
+		case <-timeout:
+			t.Fatalf("expected %d lines, got %v", count, lines)
+		}
+	}
+
+	r.Close()
+	for range lineChannel {
+	}
+	if err := r.Checkpoint(linePositions(lines)); err != nil {
+		t.Fatal(err)
+	}
+	return lines
+}
+
+//linePositions returns positions of lines. Checkpoint saves the last one of every file
+func linePositions(lines []Line) []Position {
+	var positions []Position
+	for _, line := range lines {
+		positions = append(positions, line.Position)
+	}
+	return positions
+}
+
+//readWithState resumes reading of file with state, reads count lines and saves state
+func readWithState(t *testing.T, path string, stateFile string, count int) []string {
+	r, err := CreateFileReader("file:" + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var lines []string
+	for _, line := range readLines(t, r, stateFile, count) {
+		if line.File != path {
+			t.Errorf("expected file %s, got %s", path, line.File)
+		}
+		lines = append(lines, line.Text)
+	}
+	return lines
+}
+
+func checkLines(t *testing.T, lines []string, expected ...string) {
+	t.Helper()
+	if len(lines) != len(expected) {
+		t.Fatalf("expected %q, got %q", expected, lines)
+	}
+	for i := range lines {
+		if lines[i] != expected[i] {
+			t.Fatalf("expected %q, got %q", expected, lines)
+		}
+	}
+}
+
+func TestFileResume(t *testing.T) {
+	dir, err := ioutil.TempDir("", "als_state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "access.log")
+	stateFile := filepath.Join(dir, "access.state")
+	appendToFile(t, path, "old 1\nold 2\n")
+
+	//without state file reading starts from the end
+	appendLater(t, path, "new 1\n")
+	checkLines(t, readWithState(t, path, stateFile, 1), "new 1\n")
+
+	//lines written while reader was stopped are not lost
+	appendToFile(t, path, "down 1\ndown 2\n")
+	checkLines(t, readWithState(t, path, stateFile, 2), "down 1\n", "down 2\n")
+
+	//truncated file is read from the beginning
+	if err = ioutil.WriteFile(path, []byte("truncated\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	checkLines(t, readWithState(t, path, stateFile, 1), "truncated\n")
+
+	//rotated file is read from the beginning even if it is larger than saved offset
+	if err = os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	appendToFile(t, path, "rotated 1\nrotated 2\n")
+	checkLines(t, readWithState(t, path, stateFile, 2), "rotated 1\n", "rotated 2\n")
+
+	state := new(Position)
+	if _, err = readState(stateFile, state); err != nil {
+		t.Fatal(err)
+	}
+	if state.File != path || state.Offset != int64(len("rotated 1\nrotated 2\n")) {
+		t.Errorf("unexpected state %+v", state)
+	}
+}
+
+func TestFileCheckpointBufferedLines(t *testing.T) {
+	dir, err := ioutil.TempDir("", "als_state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "access.log")
+	stateFile := filepath.Join(dir, "access.state")
+	appendToFile(t, path, "old 1\n")
+
+	r, err := CreateFileReader("file:" + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if err = r.Resume(stateFile); err != nil {
+		t.Fatal(err)
+	}
+
+	lineChannel := make(chan Line, 10)
+	go r.ReadToChannel(lineChannel)
+	appendToFile(t, path, "new 1\nnew 2\nnew 3\n")
+
+	for start := time.Now(); len(lineChannel) < 3; time.Sleep(10 * time.Millisecond) {
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("expected 3 buffered lines, got %d", len(lineChannel))
+		}
+	}
+
+	checkOffset := func(expected int) {
+		t.Helper()
+		state := new(Position)
+		if _, err := readState(stateFile, state); err != nil {
+			t.Fatal(err)
+		}
+		if state.Offset != int64(expected) {
+			t.Errorf("expected offset %d, actual %d", expected, state.Offset)
+		}
+	}
+
+	//lines are read, but not handled yet, so position is not moved
+	if err = r.Checkpoint(nil); err != nil {
+		t.Fatal(err)
+	}
+	checkOffset(len("old 1\n"))
+
+	line := <-lineChannel
+	if err = r.Checkpoint([]Position{line.Position}); err != nil {
+		t.Fatal(err)
+	}
+	checkOffset(len("old 1\nnew 1\n"))
+
+	//position of other file is ignored
+	if err = r.Checkpoint([]Position{{File: path + ".1", Offset: 100}}); err != nil {
+		t.Fatal(err)
+	}
+	checkOffset(len("old 1\nnew 1\n"))
+}
@@ -6,6 +6,7 @@ import (
 	"io"
 	"os"
 	"strings"
+	"sync"
 )
 
 //StdInputReader implements reading from stdin
@@ -14,11 +15,14 @@ type StdInputReader struct {
 
 	reader *bufio.Reader
 	nowait bool
+
+	done      chan struct{}
+	closeOnce sync.Once
 }
 
 //CreateStdinReader creates new StdInputReader
 func CreateStdinReader(dsn string) (r *StdInputReader, err error) {
-	r = &StdInputReader{}
+	r = &StdInputReader{done: make(chan struct{})}
 
 	if option := strings.Replace(dsn, "stdin:", "", 1); option == "nowait" || option == "" {
 		r.nowait = true
@@ -28,28 +32,59 @@ func CreateStdinReader(dsn string) (r *StdInputReader, err error) {
 	return r, err
 }
 
-//ReadToChannel implements ReadToChannel
-func (r *StdInputReader) ReadToChannel(lineChannel chan<- string) {
+//ReadToChannel implements ReadToChannel. lineChannel is closed on EOF or after Close
+func (r *StdInputReader) ReadToChannel(lineChannel chan<- Line) {
+	defer close(lineChannel)
+
+	//reading from stdin can't be interrupted, so it is done in background
+	lines := make(chan string)
+	go r.read(lines)
+
+	for {
+		select {
+		case <-r.done:
+			return
+		case line, more := <-lines:
+			if !more {
+				return
+			}
+			select {
+			case lineChannel <- Line{Text: line}:
+			case <-r.done:
+				return
+			}
+		}
+	}
+}
+
+func (r *StdInputReader) read(lines chan<- string) {
 	var (
 		b   []byte
 		err error
 	)
 
+	defer close(lines)
 	r.reader = bufio.NewReader(os.Stdin)
 
 	for {
 		b, err = r.reader.ReadBytes('\n')
 		if err != nil {
 			if err == io.EOF {
-				close(lineChannel)
 				break
 			}
 		} else {
-			lineChannel <- string(b)
+			select {
+			case lines <- string(b):
+			case <-r.done:
+				return
+			}
 		}
 	}
 }
 
 //Close implements Close method of BufferedReader for StdInputReader
 func (r *StdInputReader) Close() {
+	r.closeOnce.Do(func() {
+		close(r.done)
+	})
 }
@@ -30,11 +30,17 @@ type SyslogInputReader struct {
 	protocol    string
 	listen      string
 	application string
-	lineChannel chan<- string
+	lineChannel chan<- Line
 
 	acceptor Acceptor
 
 	parser *syslogParser
+
+	//closed is set by Close. Open tcp connections are closed with acceptor
+	closed    bool
+	conns     map[net.Conn]bool
+	connsLock sync.Mutex
+	handlers  sync.WaitGroup
 }
 
 //CreateSyslogInputReader created BufferedReader
@@ -44,7 +50,7 @@ type SyslogInputReader struct {
 // syslog:tcp:binding_ip:binding_port/application
 func CreateSyslogInputReader(dsn string) (r *SyslogInputReader, err error) {
 
-	r = &SyslogInputReader{}
+	r = &SyslogInputReader{conns: make(map[net.Conn]bool)}
 	r.parser, err = newSyslogParser()
 	check(err)
 	//read dsn
@@ -64,8 +70,9 @@ func (r *SyslogInputReader) parseDsn(dsn string) (err error) {
 	return
 }
 
-//ReadToChannel implements BufferedReader ReadToBuffer method for SyslogInputReader
-func (r *SyslogInputReader) ReadToChannel(lineChannel chan<- string) {
+//ReadToChannel implements BufferedReader ReadToBuffer method for SyslogInputReader.
+//lineChannel is closed after Close when all connections are handled
+func (r *SyslogInputReader) ReadToChannel(lineChannel chan<- Line) {
 
 	r.lineChannel = lineChannel
 	if r.protocol == "udp" {
@@ -74,19 +81,59 @@ func (r *SyslogInputReader) ReadToChannel(lineChannel chan<- string) {
 		r.readToBufferTCP()
 	}
 
+	r.handlers.Wait()
+	close(lineChannel)
 }
 
 //Close implements BufferedReader Close method for SyslogInputReader
 func (r *SyslogInputReader) Close() {
+	r.connsLock.Lock()
+	defer r.connsLock.Unlock()
+
+	if r.closed {
+		return
+	}
+	r.closed = true
 	r.acceptor.Close()
+
+	for conn := range r.conns {
+		conn.Close()
+	}
+}
+
+func (r *SyslogInputReader) isClosed() bool {
+	r.connsLock.Lock()
+	defer r.connsLock.Unlock()
+	return r.closed
 }
 
 func (r *SyslogInputReader) readToBufferTCP() {
 	// accept new connect and send it to handler
 	for {
 		conn, err := r.acceptor.Accept()
+		if err != nil && r.isClosed() {
+			return
+		}
 		check(err)
-		go r.handleConnectionTCP(conn)
+
+		r.connsLock.Lock()
+		if r.closed {
+			r.connsLock.Unlock()
+			conn.Close()
+			return
+		}
+		r.conns[conn] = true
+		r.handlers.Add(1)
+		r.connsLock.Unlock()
+
+		go func() {
+			defer r.handlers.Done()
+			r.handleConnectionTCP(conn)
+
+			r.connsLock.Lock()
+			delete(r.conns, conn)
+			r.connsLock.Unlock()
+		}()
 	}
 }
 
@@ -159,12 +206,15 @@ func (r *SyslogInputReader) handleConnectionUDP(conn net.Conn) {
 	for {
 		read, err = conn.Read(b)
 		if err != nil {
+			if r.isClosed() {
+				return
+			}
 			log.Println(err)
 		}
 		bytesBuf := b[0:read]
 		r.m.Lock()
 		if r.appendToBuffer(bytesBuf) {
-			r.lineChannel <- string('\n')
+			r.lineChannel <- Line{Text: string('\n')}
 		}
 		r.m.Unlock()
 		//log.Println(string(r.buffer))
@@ -180,11 +230,14 @@ func (r *SyslogInputReader) handleConnectionTCP(conn net.Conn) {
 		if err == io.EOF {
 			r.m.Lock()
 			if r.appendToBuffer(bytesBuf) {
-				r.lineChannel <- string('\n')
+				r.lineChannel <- Line{Text: string('\n')}
 			}
 			r.m.Unlock()
 			break
 		} else if err != nil {
+			if r.isClosed() {
+				break
+			}
 			check(err)
 		}
 		r.m.Lock()
@@ -210,7 +263,7 @@ func (r *SyslogInputReader) appendToBuffer(byteBuf []byte) bool {
 		return false
 	}
 
-	r.lineChannel <- string(m.Message)
+	r.lineChannel <- Line{Text: string(m.Message)}
 	return true
 }
 
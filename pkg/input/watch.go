@@ -0,0 +1,68 @@
+package input
+
+import (
+	"sync"
+	"time"
+)
+
+//pollInterval is an interval of checking file by pollWatcher
+const pollInterval = 250 * time.Millisecond
+
+//watcher wakes reading of file when it may be changed: written, truncated, renamed or created again
+type watcher interface {
+	//Events gets value when file may be changed. Several changes can be reported by one value
+	Events() <-chan struct{}
+	//Rewatch watches file of the same path after it was reopened
+	Rewatch() error
+	Close() error
+}
+
+//pollWatcher is a fallback watcher which reports changes every pollInterval
+type pollWatcher struct {
+	events    chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newPollWatcher() *pollWatcher {
+	w := &pollWatcher{events: make(chan struct{}, 1), done: make(chan struct{})}
+	go w.poll()
+	return w
+}
+
+func (w *pollWatcher) poll() {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			notify(w.events)
+		case <-w.done:
+			return
+		}
+	}
+}
+
+func (w *pollWatcher) Events() <-chan struct{} {
+	return w.events
+}
+
+func (w *pollWatcher) Rewatch() error {
+	return nil
+}
+
+func (w *pollWatcher) Close() error {
+	w.closeOnce.Do(func() {
+		close(w.done)
+	})
+	return nil
+}
+
+//notify sends value to events if there is no unread one
+func notify(events chan struct{}) {
+	select {
+	case events <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,121 @@
+package input
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	//inotifyFileMask are events of watched file. Truncation is reported as IN_MODIFY
+	inotifyFileMask = syscall.IN_MODIFY | syscall.IN_ATTRIB | syscall.IN_MOVE_SELF | syscall.IN_DELETE_SELF
+	//inotifyDirMask are events of directory of watched file. They are reported when file is created again by rotation
+	inotifyDirMask = syscall.IN_CREATE | syscall.IN_MOVED_TO | syscall.IN_MOVED_FROM | syscall.IN_DELETE
+)
+
+//inotifyWatcher watches file and its directory with inotify
+type inotifyWatcher struct {
+	fd int
+	//file is fd wrapped to be read by netpoller, so Close interrupts reading
+	file *os.File
+
+	path string
+	name []byte
+
+	dirWatch  int
+	fileWatch int
+
+	events chan struct{}
+	m      sync.Mutex
+}
+
+//newWatcher returns inotify watcher of file
+func newWatcher(path string) (watcher, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+
+	w := &inotifyWatcher{
+		fd:        fd,
+		file:      os.NewFile(uintptr(fd), "inotify"),
+		path:      path,
+		name:      []byte(filepath.Base(path)),
+		fileWatch: -1,
+		events:    make(chan struct{}, 1),
+	}
+
+	w.dirWatch, err = syscall.InotifyAddWatch(fd, filepath.Dir(path), inotifyDirMask)
+	if err == nil {
+		err = w.Rewatch()
+	}
+	if err != nil {
+		w.file.Close()
+		return nil, os.NewSyscallError("inotify_add_watch", err)
+	}
+
+	go w.read()
+	return w, nil
+}
+
+func (w *inotifyWatcher) Events() <-chan struct{} {
+	return w.events
+}
+
+//Rewatch watches inode of the path. Watch of previous inode is removed
+func (w *inotifyWatcher) Rewatch() error {
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	wd, err := syscall.InotifyAddWatch(w.fd, w.path, inotifyFileMask)
+	if err != nil {
+		return err
+	}
+	if w.fileWatch != -1 && w.fileWatch != wd {
+		//watch of deleted inode is already removed by kernel
+		syscall.InotifyRmWatch(w.fd, uint32(w.fileWatch))
+	}
+	w.fileWatch = wd
+	return nil
+}
+
+func (w *inotifyWatcher) Close() error {
+	return w.file.Close()
+}
+
+//read reports events of file and events of directory about entries with name of file until Close
+func (w *inotifyWatcher) read() {
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+
+	for {
+		n, err := w.file.Read(buf)
+		if err != nil {
+			return
+		}
+
+		changed := false
+		for i := 0; i+syscall.SizeofInotifyEvent <= n; {
+			event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[i]))
+			nameStart := i + syscall.SizeofInotifyEvent
+			i = nameStart + int(event.Len)
+
+			if int(event.Wd) != w.dirWatch || event.Mask&syscall.IN_Q_OVERFLOW != 0 {
+				changed = true
+				continue
+			}
+
+			//name is padded with zeros
+			name := bytes.TrimRight(buf[nameStart:i], "\x00")
+			if bytes.Equal(name, w.name) {
+				changed = true
+			}
+		}
+
+		if changed {
+			notify(w.events)
+		}
+	}
+}
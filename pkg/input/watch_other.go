@@ -0,0 +1,8 @@
+//+build !linux
+
+package input
+
+//newWatcher returns pollWatcher. inotify is available only on linux
+func newWatcher(path string) (watcher, error) {
+	return newPollWatcher(), nil
+}
@@ -0,0 +1,182 @@
+package logformat
+
+import (
+	"fmt"
+	"strings"
+)
+
+//ApachePresets are well-known LogFormat nicknames of httpd
+var ApachePresets = map[string]string{
+	"common":   `%h %l %u %t "%r" %>s %b`,
+	"combined": `%h %l %u %t "%r" %>s %b "%{Referer}i" "%{User-agent}i"`,
+}
+
+type apacheDirective struct {
+	field   string
+	pattern string
+}
+
+//apacheDirectives contains fields of LogFormat directives without {param}
+var apacheDirectives = map[byte]apacheDirective{
+	'a': {"remote_addr", `\S+`},
+	'A': {"local_addr", `\S+`},
+	'B': {"bytes", `\d+`},
+	'b': {"bytes_sent", `\d+|-`},
+	'D': {"time_us", `\d+`},
+	'f': {"filename", ""},
+	'h': {"remote_host", `\S+`},
+	'H': {"protocol", ""},
+	'I': {"bytes_received", `\d+`},
+	'k': {"keepalive", `\d+`},
+	'l': {"remote_logname", `\S+`},
+	'L': {"log_id", `\S+`},
+	'm': {"method", `[A-Z]+`},
+	'O': {"bytes_out", `\d+`},
+	'p': {"port", `\d+`},
+	'P': {"pid", `\d+`},
+	'q': {"query_string", ""},
+	'r': {"request", ""},
+	'R': {"handler", ""},
+	's': {"status", `\d{3}`},
+	'S': {"bytes_transferred", `\d+`},
+	't': {"time_local", `[^\]]+`},
+	'T': {"time_s", `\d+`},
+	'u': {"remote_user", `\S+`},
+	'U': {"url_path", ""},
+	'v': {"server_name", `\S+`},
+	'V': {"vhost", `\S+`},
+	'X': {"connection_status", `[X+-]`},
+}
+
+//apacheHeaderPrefixes contains prefixes of fields of %{Name}X directives
+var apacheHeaderPrefixes = map[byte]string{
+	'i': "http_",
+	'o': "sent_http_",
+	'C': "cookie_",
+	'e': "env_",
+	'n': "note_",
+}
+
+//Apache returns regular expression for httpd LogFormat string or preset name (common, combined).
+//Directives become named groups: %h -> remote_host, %>s -> status, %{User-Agent}i -> http_user_agent.
+//See ApachePresets and apacheDirectives for names of fields
+func Apache(format string) (string, error) {
+	if preset, ok := ApachePresets[format]; ok {
+		format = preset
+	}
+
+	var (
+		parts   []part
+		literal strings.Builder
+		fields  int
+	)
+
+	addField := func(p part) {
+		if literal.Len() > 0 {
+			parts = append(parts, part{literal: literal.String()})
+			literal.Reset()
+		}
+		parts = append(parts, p)
+		fields++
+	}
+
+	for i := 0; i < len(format); i++ {
+		c := format[i]
+
+		if c == '\\' && i+1 < len(format) {
+			i++
+			switch format[i] {
+			case 'n':
+				literal.WriteByte('\n')
+			case 't':
+				literal.WriteByte('\t')
+			default:
+				literal.WriteByte(format[i])
+			}
+			continue
+		}
+
+		if c != '%' {
+			literal.WriteByte(c)
+			continue
+		}
+
+		start := i
+		i++
+		if i < len(format) && format[i] == '%' {
+			literal.WriteByte('%')
+			continue
+		}
+
+		//modifiers of status conditions and original/final request: %>s, %400,501{User-agent}i
+		for i < len(format) && strings.IndexByte("<>!,0123456789", format[i]) >= 0 {
+			i++
+		}
+
+		param := ""
+		if i < len(format) && format[i] == '{' {
+			end := strings.IndexByte(format[i:], '}')
+			if end < 0 {
+				return "", fmt.Errorf("unterminated {} of directive at position %d", start)
+			}
+			param = format[i+1 : i+end]
+			i += end + 1
+		}
+
+		if i == len(format) {
+			return "", fmt.Errorf("incomplete directive at position %d", start)
+		}
+
+		p, err := apachePart(format[i], param)
+		if err != nil {
+			return "", fmt.Errorf("%s at position %d", err, start)
+		}
+
+		//%t is written in brackets, brackets are not a part of time
+		if format[i] == 't' && param == "" {
+			literal.WriteByte('[')
+			addField(p)
+			literal.WriteByte(']')
+			continue
+		}
+		addField(p)
+	}
+
+	if fields == 0 {
+		return "", fmt.Errorf("LogFormat \"%s\" has no directives", format)
+	}
+	if literal.Len() > 0 {
+		parts = append(parts, part{literal: literal.String()})
+	}
+
+	return compile(parts), nil
+}
+
+func apachePart(directive byte, param string) (part, error) {
+	if prefix, ok := apacheHeaderPrefixes[directive]; ok {
+		if param == "" {
+			return part{}, fmt.Errorf("directive %%%c requires {name}", directive)
+		}
+		return part{field: prefix + fieldName(param)}, nil
+	}
+
+	d, ok := apacheDirectives[directive]
+	if !ok {
+		return part{}, fmt.Errorf("unknown directive %%%c", directive)
+	}
+
+	switch {
+	case param == "":
+		return part{field: d.field, pattern: d.pattern}, nil
+	case directive == 't':
+		//strftime format of time
+		return part{field: d.field}, nil
+	case directive == 'T':
+		//%{ms}T, %{us}T, %{s}T
+		return part{field: "time_" + fieldName(param), pattern: d.pattern}, nil
+	case directive == 'p' || directive == 'P':
+		//%{remote}p, %{tid}P
+		return part{field: fieldName(param) + "_" + d.field, pattern: `\S+`}, nil
+	}
+	return part{field: d.field, pattern: d.pattern}, nil
+}
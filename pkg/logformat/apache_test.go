@@ -0,0 +1,90 @@
+package logformat_test
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/blackbass1988/access_logs_stats/pkg/logformat"
+)
+
+func TestApache(t *testing.T) {
+	cases := []struct {
+		format   string
+		line     string
+		expected map[string]string
+	}{
+		{
+			"combined",
+			`10.0.0.1 - frank [18/Oct/2026:10:00:00 +0300] "GET /index.html HTTP/1.1" 200 2326 "-" "curl/7.68.0"`,
+			map[string]string{
+				"remote_host":     "10.0.0.1",
+				"remote_logname":  "-",
+				"remote_user":     "frank",
+				"time_local":      "18/Oct/2026:10:00:00 +0300",
+				"request":         "GET /index.html HTTP/1.1",
+				"status":          "200",
+				"bytes_sent":      "2326",
+				"http_referer":    "-",
+				"http_user_agent": "curl/7.68.0",
+			},
+		},
+		{
+			`%h %l %u %t \"%r\" %>s %b %D`,
+			`::1 - - [18/Oct/2026:10:00:00 +0300] "HEAD / HTTP/1.0" 304 - 1520`,
+			map[string]string{
+				"remote_host": "::1",
+				"status":      "304",
+				"bytes_sent":  "-",
+				"time_us":     "1520",
+			},
+		},
+		{
+			`%v:%p "%{X-Forwarded-For}i" %{ms}T %400,501{Host}i 100%%`,
+			`example.com:443 "1.2.3.4, 5.6.7.8" 12 - 100%`,
+			map[string]string{
+				"server_name":          "example.com",
+				"port":                 "443",
+				"http_x_forwarded_for": "1.2.3.4, 5.6.7.8",
+				"time_ms":              "12",
+				"http_host":            "-",
+			},
+		},
+	}
+
+	for _, c := range cases {
+		expression, err := logformat.Apache(c.format)
+		if err != nil {
+			t.Errorf("%s: %s", c.format, err)
+			continue
+		}
+
+		rex := regexp.MustCompile(expression)
+		matches := rex.FindStringSubmatch(c.line)
+		if matches == nil {
+			t.Errorf("%s doesn't match %s", expression, c.line)
+			continue
+		}
+
+		names := make(map[string]bool)
+		for i, name := range rex.SubexpNames() {
+			names[name] = true
+			if expected, ok := c.expected[name]; ok && matches[i] != expected {
+				t.Errorf("%s: expected %s, actual %s", name, expected, matches[i])
+			}
+		}
+
+		for name := range c.expected {
+			if !names[name] {
+				t.Errorf("%s: field %s not found", c.format, name)
+			}
+		}
+	}
+}
+
+func TestApacheErrors(t *testing.T) {
+	for _, format := range []string{"", "no directives", "%h %", "%{Host", "%{Host}", "%j", "%i"} {
+		if _, err := logformat.Apache(format); err == nil {
+			t.Errorf("format %s must fail", format)
+		}
+	}
+}
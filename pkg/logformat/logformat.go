@@ -0,0 +1,66 @@
+//Package logformat translates log format directives of web servers into regular expressions with named groups
+package logformat
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+//part is a literal text or a field of log format
+type part struct {
+	literal string
+	field   string
+	//pattern of field. If empty, field matches everything up to the next literal
+	pattern string
+}
+
+//compile returns regular expression for parts of log format
+func compile(parts []part) string {
+	var result strings.Builder
+	used := make(map[string]bool)
+	result.WriteString("^")
+
+	for i, p := range parts {
+		if p.field == "" {
+			result.WriteString(regexp.QuoteMeta(p.literal))
+			continue
+		}
+
+		pattern := p.pattern
+		if pattern == "" {
+			pattern = untilNext(parts[i+1:])
+		}
+
+		//second group with the same name is not allowed by libpcre
+		if used[p.field] {
+			fmt.Fprintf(&result, "(?:%s)", pattern)
+		} else {
+			fmt.Fprintf(&result, "(?P<%s>%s)", p.field, pattern)
+			used[p.field] = true
+		}
+	}
+	result.WriteString("$")
+
+	return result.String()
+}
+
+//untilNext returns pattern which matches everything up to the first character of next literal
+func untilNext(rest []part) string {
+	if len(rest) == 0 || rest[0].literal == "" {
+		return ".*"
+	}
+
+	c := rest[0].literal[0]
+	if c == ']' || c == '\\' || c == '^' || c == '-' {
+		return fmt.Sprintf(`[^\%c]*`, c)
+	}
+	return fmt.Sprintf(`[^%c]*`, c)
+}
+
+var nonWordRex = regexp.MustCompile(`\W+`)
+
+//fieldName returns valid name of group for s, e.g. User-Agent -> user_agent
+func fieldName(s string) string {
+	return nonWordRex.ReplaceAllString(strings.ToLower(s), "_")
+}
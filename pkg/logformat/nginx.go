@@ -0,0 +1,106 @@
+package logformat
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+//upstreamPattern matches one value or list of values of several upstreams, e.g. "0.001, 0.002 : 0.010"
+const upstreamPattern = `[^ ,]+(?:(?:, | : )[^ ,]+)*`
+
+//nginxPatterns contains patterns of nginx variables with well-known values.
+//Other variables match everything up to the next character of format
+var nginxPatterns = map[string]string{
+	"status":                   `\d{3}`,
+	"body_bytes_sent":          `\d+`,
+	"bytes_sent":               `\d+`,
+	"request_length":           `\d+`,
+	"connection":               `\d+`,
+	"connection_requests":      `\d+`,
+	"pid":                      `\d+`,
+	"server_port":              `\d+`,
+	"remote_port":              `\d*`,
+	"request_time":             `\d+\.\d+`,
+	"msec":                     `\d+\.\d+`,
+	"upstream_addr":            upstreamPattern,
+	"upstream_status":          upstreamPattern,
+	"upstream_response_time":   upstreamPattern,
+	"upstream_connect_time":    upstreamPattern,
+	"upstream_header_time":     upstreamPattern,
+	"upstream_response_length": upstreamPattern,
+	"upstream_bytes_received":  upstreamPattern,
+	"upstream_bytes_sent":      upstreamPattern,
+	"upstream_cache_status":    `[A-Z]*|-`,
+}
+
+var nginxVariableRex = regexp.MustCompile(`\$(?:\{(\w+)\}|(\w+))`)
+
+//Nginx returns regular expression for nginx log_format string.
+//Every variable becomes a named group without "$", e.g. $request_time -> (?P<request_time>\d+\.\d+).
+//Format can be given as is or in nginx quotes: '$remote_addr - $remote_user ' '"$request"'
+func Nginx(format string) (string, error) {
+	format, err := unquoteNginx(format)
+	if err != nil {
+		return "", err
+	}
+
+	if !nginxVariableRex.MatchString(format) {
+		return "", fmt.Errorf("log_format \"%s\" has no variables", format)
+	}
+
+	var parts []part
+	last := 0
+	for _, loc := range nginxVariableRex.FindAllStringSubmatchIndex(format, -1) {
+		if loc[0] > last {
+			parts = append(parts, part{literal: format[last:loc[0]]})
+		}
+		last = loc[1]
+
+		var name string
+		if loc[2] >= 0 {
+			name = format[loc[2]:loc[3]]
+		} else {
+			name = format[loc[4]:loc[5]]
+		}
+		parts = append(parts, part{field: name, pattern: nginxPatterns[name]})
+	}
+	if last < len(format) {
+		parts = append(parts, part{literal: format[last:]})
+	}
+
+	return compile(parts), nil
+}
+
+//unquoteNginx joins strings of nginx config syntax: '...' "..." parts separated by spaces.
+//Unquoted format is returned as is
+func unquoteNginx(format string) (string, error) {
+	trimmed := strings.TrimSpace(format)
+	if trimmed == "" || trimmed[0] != '\'' && trimmed[0] != '"' {
+		return format, nil
+	}
+
+	var result strings.Builder
+	for i := 0; i < len(trimmed); i++ {
+		c := trimmed[i]
+		if c == ' ' || c == '\t' || c == '\n' || c == '\r' {
+			continue
+		}
+		if c != '\'' && c != '"' {
+			return "", fmt.Errorf("unexpected symbol '%c' between quoted parts of log_format", c)
+		}
+
+		end := i + 1
+		for ; end < len(trimmed) && trimmed[end] != c; end++ {
+			if trimmed[end] == '\\' && end+1 < len(trimmed) {
+				end++
+			}
+			result.WriteByte(trimmed[end])
+		}
+		if end == len(trimmed) {
+			return "", fmt.Errorf("unterminated quoted part of log_format")
+		}
+		i = end
+	}
+	return result.String(), nil
+}
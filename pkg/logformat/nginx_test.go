@@ -0,0 +1,81 @@
+package logformat_test
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/blackbass1988/access_logs_stats/pkg/logformat"
+)
+
+const combined = `$remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent "$http_referer" "$http_user_agent"`
+
+func TestNginx(t *testing.T) {
+	cases := []struct {
+		format   string
+		line     string
+		expected map[string]string
+	}{
+		{
+			combined,
+			`10.0.0.1 - - [18/Oct/2026:10:00:00 +0300] "GET /api/v1/users?id=1 HTTP/1.1" 200 612 "-" "Mozilla/5.0 (X11; Linux x86_64)"`,
+			map[string]string{
+				"remote_addr":     "10.0.0.1",
+				"remote_user":     "-",
+				"time_local":      "18/Oct/2026:10:00:00 +0300",
+				"request":         "GET /api/v1/users?id=1 HTTP/1.1",
+				"status":          "200",
+				"body_bytes_sent": "612",
+				"http_referer":    "-",
+				"http_user_agent": "Mozilla/5.0 (X11; Linux x86_64)",
+			},
+		},
+		{
+			`'$host [$time_local] "$request" $status ' '$request_time $upstream_response_time ${upstream_status}'`,
+			`api.example.com [18/Oct/2026:10:00:00 +0300] "POST /login HTTP/2.0" 502 1.005 0.500, 0.505 502, 502`,
+			map[string]string{
+				"host":                   "api.example.com",
+				"status":                 "502",
+				"request_time":           "1.005",
+				"upstream_response_time": "0.500, 0.505",
+				"upstream_status":        "502, 502",
+			},
+		},
+		{
+			`$status $status|$msec`,
+			`404 404|1760770800.123`,
+			map[string]string{
+				"status": "404",
+				"msec":   "1760770800.123",
+			},
+		},
+	}
+
+	for _, c := range cases {
+		expression, err := logformat.Nginx(c.format)
+		if err != nil {
+			t.Errorf("%s: %s", c.format, err)
+			continue
+		}
+
+		rex := regexp.MustCompile(expression)
+		matches := rex.FindStringSubmatch(c.line)
+		if matches == nil {
+			t.Errorf("%s doesn't match %s", expression, c.line)
+			continue
+		}
+
+		for i, name := range rex.SubexpNames() {
+			if expected, ok := c.expected[name]; ok && matches[i] != expected {
+				t.Errorf("%s: expected %s, actual %s", name, expected, matches[i])
+			}
+		}
+	}
+}
+
+func TestNginxErrors(t *testing.T) {
+	for _, format := range []string{"", "no variables", `'$status`, `'$status' x`} {
+		if _, err := logformat.Nginx(format); err == nil {
+			t.Errorf("format %s must fail", format)
+		}
+	}
+}
@@ -0,0 +1,289 @@
+//Package metrics contains registry of internal metrics of application: counters, gauges and summaries
+//with labels. Registry is exposed in prometheus text format and as samples for outputs
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const contentType = "text/plain; version=0.0.4; charset=utf-8"
+
+//Counter is a monotonically increasing value
+type Counter struct {
+	v uint64
+}
+
+//Inc increments counter
+func (c *Counter) Inc() {
+	atomic.AddUint64(&c.v, 1)
+}
+
+//Add adds n to counter
+func (c *Counter) Add(n uint64) {
+	atomic.AddUint64(&c.v, n)
+}
+
+//Value returns current value of counter
+func (c *Counter) Value() uint64 {
+	return atomic.LoadUint64(&c.v)
+}
+
+//Gauge is a value which can go up and down
+type Gauge struct {
+	bits uint64
+}
+
+//Set sets value of gauge
+func (g *Gauge) Set(v float64) {
+	atomic.StoreUint64(&g.bits, math.Float64bits(v))
+}
+
+//Value returns current value of gauge
+func (g *Gauge) Value() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&g.bits))
+}
+
+//Summary counts observations and their sum, e.g. durations in seconds.
+//It is lock free, because it is observed for every line
+type Summary struct {
+	count   uint64
+	sumBits uint64
+}
+
+//Observe adds observation
+func (s *Summary) Observe(v float64) {
+	atomic.AddUint64(&s.count, 1)
+	for {
+		old := atomic.LoadUint64(&s.sumBits)
+		sum := math.Float64bits(math.Float64frombits(old) + v)
+		if atomic.CompareAndSwapUint64(&s.sumBits, old, sum) {
+			return
+		}
+	}
+}
+
+//ObserveSince adds duration from start in seconds
+func (s *Summary) ObserveSince(start time.Time) {
+	s.Observe(time.Since(start).Seconds())
+}
+
+//Value returns count and sum of observations
+func (s *Summary) Value() (count uint64, sum float64) {
+	return atomic.LoadUint64(&s.count), math.Float64frombits(atomic.LoadUint64(&s.sumBits))
+}
+
+//Sample is a value of metric. Counters have metric "total", gauges - "value", summaries - "count" and "sum"
+type Sample struct {
+	Name   string
+	Metric string
+	Labels map[string]string
+	Value  float64
+}
+
+//FullName returns name of sample in prometheus style: lines_read_total, parse_seconds_count, backlog
+func (s Sample) FullName() string {
+	if s.Metric == "value" {
+		return s.Name
+	}
+	return s.Name + "_" + s.Metric
+}
+
+type entry struct {
+	name   string
+	labels map[string]string
+	metric interface{}
+	//refs is a count of getting of metric which are not unregistered yet
+	refs int
+}
+
+//family returns name and type of metric in prometheus text format
+func (e *entry) family() (name string, typ string) {
+	switch e.metric.(type) {
+	case *Counter:
+		return e.name + "_total", "counter"
+	case *Gauge:
+		return e.name, "gauge"
+	}
+	return e.name, "summary"
+}
+
+func (e *entry) samples() []Sample {
+	switch m := e.metric.(type) {
+	case *Counter:
+		return []Sample{{e.name, "total", e.labels, float64(m.Value())}}
+	case *Gauge:
+		return []Sample{{e.name, "value", e.labels, m.Value()}}
+	case *Summary:
+		count, sum := m.Value()
+		return []Sample{
+			{e.name, "count", e.labels, float64(count)},
+			{e.name, "sum", e.labels, sum},
+		}
+	}
+	return nil
+}
+
+//Registry contains metrics by name and labels
+type Registry struct {
+	//Namespace is a prefix of names in prometheus text format
+	Namespace string
+
+	entries map[string]*entry
+	m       sync.Mutex
+}
+
+//NewRegistry returns empty registry
+func NewRegistry(namespace string) *Registry {
+	return &Registry{Namespace: namespace, entries: make(map[string]*entry)}
+}
+
+//Default is a registry of application
+var Default = NewRegistry("als")
+
+func key(name string, labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString(name)
+	for _, k := range keys {
+		b.WriteString("\x00" + k + "\x00" + labels[k])
+	}
+	return b.String()
+}
+
+//get returns metric with name and labels or creates it with newMetric
+func (r *Registry) get(name string, labels map[string]string, newMetric func() interface{}) interface{} {
+	k := key(name, labels)
+
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	if e, ok := r.entries[k]; ok {
+		e.refs++
+		return e.metric
+	}
+
+	copied := make(map[string]string, len(labels))
+	for k, v := range labels {
+		copied[k] = v
+	}
+	e := &entry{name: name, labels: copied, metric: newMetric(), refs: 1}
+	r.entries[k] = e
+	return e.metric
+}
+
+//Unregister releases metrics got from registry. Metric is removed when all its users unregister it,
+//e.g. metrics of filters and outputs which are removed by config reload
+func (r *Registry) Unregister(metrics ...interface{}) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	for _, metric := range metrics {
+		for k, e := range r.entries {
+			if e.metric != metric {
+				continue
+			}
+			if e.refs--; e.refs <= 0 {
+				delete(r.entries, k)
+			}
+			break
+		}
+	}
+}
+
+//Counter returns counter with name and labels. It panics if metric with the same name and labels is not a counter
+func (r *Registry) Counter(name string, labels map[string]string) *Counter {
+	return r.get(name, labels, func() interface{} { return new(Counter) }).(*Counter)
+}
+
+//Gauge returns gauge with name and labels
+func (r *Registry) Gauge(name string, labels map[string]string) *Gauge {
+	return r.get(name, labels, func() interface{} { return new(Gauge) }).(*Gauge)
+}
+
+//Summary returns summary with name and labels
+func (r *Registry) Summary(name string, labels map[string]string) *Summary {
+	return r.get(name, labels, func() interface{} { return new(Summary) }).(*Summary)
+}
+
+//Samples returns current values of all metrics sorted by name and labels
+func (r *Registry) Samples() []Sample {
+	r.m.Lock()
+	keys := make([]string, 0, len(r.entries))
+	for k := range r.entries {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var samples []Sample
+	for _, k := range keys {
+		samples = append(samples, r.entries[k].samples()...)
+	}
+	r.m.Unlock()
+
+	return samples
+}
+
+//ServeHTTP writes metrics in prometheus text exposition format
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", contentType)
+
+	prefix := ""
+	if r.Namespace != "" {
+		prefix = r.Namespace + "_"
+	}
+
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	//entries with the same name are adjacent in order of keys, so every family gets one TYPE line
+	keys := make([]string, 0, len(r.entries))
+	for k := range r.entries {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	prevFamily := ""
+	for _, k := range keys {
+		e := r.entries[k]
+		if family, typ := e.family(); family != prevFamily {
+			fmt.Fprintf(w, "# TYPE %s%s %s\n", prefix, family, typ)
+			prevFamily = family
+		}
+		for _, s := range e.samples() {
+			fmt.Fprintf(w, "%s%s%s %v\n", prefix, s.FullName(), formatLabels(s.Labels), s.Value)
+		}
+	}
+}
+
+func formatLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		v := strings.Replace(labels[k], `\`, `\\`, -1)
+		v = strings.Replace(v, "\n", `\n`, -1)
+		v = strings.Replace(v, `"`, `\"`, -1)
+		pairs[i] = fmt.Sprintf(`%s="%s"`, k, v)
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
@@ -0,0 +1,77 @@
+package metrics_test
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/blackbass1988/access_logs_stats/pkg/metrics"
+)
+
+func TestRegistry(t *testing.T) {
+	r := metrics.NewRegistry("als")
+
+	r.Counter("lines_read", map[string]string{"input": "file:a.log"}).Add(3)
+	r.Counter("lines_read", map[string]string{"input": "file:a.log"}).Inc()
+	r.Counter("lines_read", map[string]string{"input": "file:b.log"}).Inc()
+	r.Gauge("line_channel_backlog", nil).Set(7)
+	r.Summary("parse_seconds", nil).Observe(0.5)
+	r.Summary("parse_seconds", nil).Observe(0.25)
+
+	if v := r.Counter("lines_read", map[string]string{"input": "file:a.log"}).Value(); v != 4 {
+		t.Errorf("expected counter 4, actual %d", v)
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := ioutil.ReadAll(w.Body)
+
+	expected := `# TYPE als_line_channel_backlog gauge
+als_line_channel_backlog 7
+# TYPE als_lines_read_total counter
+als_lines_read_total{input="file:a.log"} 4
+als_lines_read_total{input="file:b.log"} 1
+# TYPE als_parse_seconds summary
+als_parse_seconds_count 2
+als_parse_seconds_sum 0.75
+`
+	if string(body) != expected {
+		t.Errorf("expected:\n%s\nactual:\n%s", expected, body)
+	}
+}
+
+func TestRegistryUnregister(t *testing.T) {
+	r := metrics.NewRegistry("")
+	labels := map[string]string{"filter": "api"}
+
+	//metric is shared by two users and removed only when both unregister it
+	first := r.Counter("invalid_numbers", labels)
+	second := r.Counter("invalid_numbers", labels)
+	first.Inc()
+
+	r.Unregister(first)
+	if len(r.Samples()) != 1 {
+		t.Fatalf("metric must be kept until all users unregister it, actual %v", r.Samples())
+	}
+
+	r.Unregister(second)
+	if len(r.Samples()) != 0 {
+		t.Fatalf("metric must be removed, actual %v", r.Samples())
+	}
+
+	if v := r.Counter("invalid_numbers", labels).Value(); v != 0 {
+		t.Errorf("metric registered again must be new, actual value %d", v)
+	}
+}
+
+func TestRegistryTypeConflict(t *testing.T) {
+	r := metrics.NewRegistry("")
+	r.Counter("x", nil)
+
+	defer func() {
+		if recover() == nil {
+			t.Error("metric with the same name and labels but other type must panic")
+		}
+	}()
+	r.Gauge("x", nil)
+}
@@ -1,46 +1,51 @@
 package console
 
 import (
+	"fmt"
 	"log"
 
 	"github.com/blackbass1988/access_logs_stats/pkg/output"
 	"github.com/blackbass1988/access_logs_stats/pkg/template"
 )
 
-var c *console
-
 type console struct {
 	template     *template.Template
 	templateVars map[string]string
 }
 
-func (c *console) send(field string, metric string, value string) {
+func (c *console) send(field string, metric string, value string, templateVars map[string]string) error {
 
-	err, key := c.template.Process(field, metric, c.templateVars)
+	err, key := c.template.Process(field, metric, templateVars)
 
 	if err != nil {
 		log.Println("ERROR:", err)
+		output.CountSendError("console")
 	} else {
 		log.Printf("%s = %s\n", key, value)
 	}
 
+	return err
 }
 
-//Send sends messages to console
-func Send(messages []*output.Message) {
+//Send sends messages to console. It returns the last template error
+func (c *console) Send(messages []*output.Message) (err error) {
 
 	for _, message := range messages {
-		c.send(message.Field, message.Metric, message.Value)
+		if e := c.send(message.Field, message.Metric, message.Value, message.Vars(c.templateVars)); e != nil {
+			err = e
+		}
 	}
 
+	return err
 }
 
-//Init initializes console sender
-func Init(params map[string]string, templateVars map[string]string) {
+//New creates new console sender
+func New(params map[string]string, templateVars map[string]string) (output.Target, error) {
 	var err error
 	var templateString string
 	var ok bool
 
+	c := new(console)
 	c.templateVars = templateVars
 	if templateString, ok = params["template"]; !ok {
 		templateString = output.DefaultTemplate
@@ -49,12 +54,12 @@ func Init(params map[string]string, templateVars map[string]string) {
 	err, c.template = template.NewTempate(templateString)
 
 	if err != nil {
-		log.Fatalf("template init failed for template \"%s\". Error: \"%s\"", templateString, err.Error())
+		return nil, fmt.Errorf("template init failed for template \"%s\". Error: \"%s\"", templateString, err.Error())
 	}
 
+	return c, nil
 }
 
 func init() {
-	c = new(console)
-	output.RegisterOutput("console", Send, Init)
+	output.RegisterOutput("console", New)
 }
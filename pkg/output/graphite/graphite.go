@@ -0,0 +1,212 @@
+package graphite
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/blackbass1988/access_logs_stats/pkg/output"
+	"github.com/blackbass1988/access_logs_stats/pkg/template"
+)
+
+const (
+	udpSafePackSize = 1432
+	dialTimeout     = 5 * time.Second
+	writeTimeout    = 5 * time.Second
+	minBackoff      = 1 * time.Second
+	maxBackoff      = 1 * time.Minute
+)
+
+type graphite struct {
+	graphiteHost string
+	graphitePort string
+	protocol     string
+
+	template     *template.Template
+	templateVars map[string]string
+
+	conn net.Conn
+
+	//delay before next connect attempt. grows twice on every failure
+	backoff   time.Duration
+	nextRetry time.Time
+
+	m sync.Mutex
+}
+
+func (g *graphite) getLines(messages []*output.Message) [][]byte {
+	var lines [][]byte
+
+	for _, message := range messages {
+		err, key := g.template.Process(message.Field, message.Metric, message.Vars(g.templateVars))
+
+		if err != nil {
+			log.Println("graphite template error:", err)
+			output.CountSendError("graphite")
+			continue
+		}
+
+		ts := message.Time
+		if ts.IsZero() {
+			ts = time.Now()
+		}
+
+		key = strings.Replace(key, " ", "_", -1)
+		lines = append(lines, []byte(fmt.Sprintf("%s %s %d\n", key, message.Value, ts.Unix())))
+	}
+	return lines
+}
+
+//Send sends messages to graphite
+func (g *graphite) Send(messages []*output.Message) error {
+	lines := g.getLines(messages)
+	if len(lines) == 0 {
+		return nil
+	}
+
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	written, err := g.write(lines)
+	if err != nil {
+		//connection may be closed by server since last period. reconnect and send the rest once again
+		log.Println("graphite write error:", err)
+		g.closeConn()
+		lines = lines[written:]
+		written, err = g.write(lines)
+	}
+
+	if err != nil {
+		log.Println("graphite write error:", err, "lost", len(lines)-written, "lines")
+		output.CountSendError("graphite")
+		g.closeConn()
+	}
+	return err
+}
+
+//write writes lines to connection. It returns count of lines which were written completely
+func (g *graphite) write(lines [][]byte) (written int, err error) {
+	if err = g.connect(); err != nil {
+		return 0, err
+	}
+
+	g.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+
+	if g.protocol == "udp" {
+		//udp packet must contain only whole lines
+		buf := new(bytes.Buffer)
+		for i, line := range lines {
+			if buf.Len() > 0 && buf.Len()+len(line) > udpSafePackSize {
+				if _, err = g.conn.Write(buf.Bytes()); err != nil {
+					return written, err
+				}
+				buf.Reset()
+				written = i
+			}
+			buf.Write(line)
+		}
+		if _, err = g.conn.Write(buf.Bytes()); err != nil {
+			return written, err
+		}
+		return len(lines), nil
+	}
+
+	n, err := g.conn.Write(bytes.Join(lines, nil))
+	//partially written line is sent again as a whole, because its beginning is dropped with closed connection
+	for written < len(lines) && n >= len(lines[written]) {
+		n -= len(lines[written])
+		written++
+	}
+	return written, err
+}
+
+func (g *graphite) connect() (err error) {
+	if g.conn != nil {
+		return nil
+	}
+
+	if time.Now().Before(g.nextRetry) {
+		return fmt.Errorf("reconnect delayed until %s", g.nextRetry.Format(time.RFC3339))
+	}
+
+	g.conn, err = net.DialTimeout(g.protocol, net.JoinHostPort(g.graphiteHost, g.graphitePort), dialTimeout)
+	if err != nil {
+		g.conn = nil
+		if g.backoff == 0 {
+			g.backoff = minBackoff
+		} else {
+			g.backoff *= 2
+		}
+		if g.backoff > maxBackoff {
+			g.backoff = maxBackoff
+		}
+		g.nextRetry = time.Now().Add(g.backoff)
+		return err
+	}
+
+	g.backoff = 0
+	return nil
+}
+
+//Close closes connection to graphite
+func (g *graphite) Close() error {
+	g.m.Lock()
+	g.closeConn()
+	g.m.Unlock()
+	return nil
+}
+
+func (g *graphite) closeConn() {
+	if g.conn != nil {
+		g.conn.Close()
+		g.conn = nil
+	}
+}
+
+//New creates new graphite sender
+func New(params map[string]string, templateVars map[string]string) (output.Target, error) {
+	var err error
+
+	g := new(graphite)
+	g.templateVars = templateVars
+	g.protocol = "tcp"
+	templateString := output.DefaultTemplate
+
+	for k, v := range params {
+		switch k {
+		case "graphite_host":
+			g.graphiteHost = v
+		case "graphite_port":
+			g.graphitePort = v
+		case "protocol":
+			g.protocol = v
+		case "template":
+			templateString = v
+		}
+	}
+
+	err, g.template = template.NewTempate(templateString)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template %s error was: %s", templateString, err)
+	}
+
+	if g.graphiteHost == "" || g.graphitePort == "" {
+		return nil, errors.New("graphite settings is incorrect. You must specify " +
+			"graphite_host and graphite_port")
+	}
+
+	if g.protocol != "tcp" && g.protocol != "udp" {
+		return nil, errors.New("graphite settings is incorrect. protocol must be tcp or udp")
+	}
+
+	return g, nil
+}
+
+func init() {
+	output.RegisterOutput("graphite", New)
+}
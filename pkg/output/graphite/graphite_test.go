@@ -0,0 +1,159 @@
+package graphite
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/blackbass1988/access_logs_stats/pkg/output"
+	"github.com/blackbass1988/access_logs_stats/pkg/template"
+)
+
+func newTestGraphite(t *testing.T, addr string) *graphite {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, tmpl := template.NewTempate("${host}.${field}.${metric}")
+
+	return &graphite{
+		graphiteHost: host,
+		graphitePort: port,
+		protocol:     "tcp",
+		template:     tmpl,
+		templateVars: map[string]string{"host": "web1"},
+	}
+}
+
+func TestSendReusesConnection(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	g := newTestGraphite(t, l.Addr().String())
+	tick := time.Unix(1500000000, 0)
+
+	go func() {
+		g.Send([]*output.Message{{Field: "time", Metric: "avg", Value: "0.132", Time: tick}})
+		g.Send([]*output.Message{{Field: "code", Metric: "cps_200", Value: "10.000", Time: tick}})
+	}()
+
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	r := bufio.NewReader(conn)
+	for _, expected := range []string{
+		"web1.time.avg 0.132 1500000000\n",
+		"web1.code.cps_200 10.000 1500000000\n",
+	} {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if line != expected {
+			t.Errorf("expected [%s] actual [%s]", expected, line)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	g := newTestGraphite(t, addr)
+	g.Send([]*output.Message{{Field: "time", Metric: "avg", Value: "1"}})
+
+	if g.backoff != minBackoff {
+		t.Errorf("backoff expected %s actual %s", minBackoff, g.backoff)
+	}
+	if g.conn != nil {
+		t.Error("connection must be nil")
+	}
+
+	//next attempt is delayed and must not touch backoff
+	g.Send([]*output.Message{{Field: "time", Metric: "avg", Value: "1"}})
+	if g.backoff != minBackoff {
+		t.Errorf("backoff expected %s actual %s", minBackoff, g.backoff)
+	}
+
+	//doubled backoff doesn't exceed max one
+	g.backoff = 45 * time.Second
+	g.nextRetry = time.Time{}
+	g.Send([]*output.Message{{Field: "time", Metric: "avg", Value: "1"}})
+	if g.backoff != maxBackoff {
+		t.Errorf("backoff expected %s actual %s", maxBackoff, g.backoff)
+	}
+}
+
+//partialConn writes only limit bytes and fails then
+type partialConn struct {
+	net.Conn
+	limit int
+}
+
+func (c *partialConn) Write(b []byte) (int, error) {
+	if len(b) > c.limit {
+		return c.limit, errors.New("broken pipe")
+	}
+	return len(b), nil
+}
+
+func (c *partialConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
+
+func (c *partialConn) Close() error {
+	return nil
+}
+
+func TestSendRestAfterPartialWrite(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	g := newTestGraphite(t, l.Addr().String())
+	tick := time.Unix(1500000000, 0)
+
+	//first line and a half of second one are written before connection is broken
+	g.conn = &partialConn{limit: len("web1.time.avg 0.132 1500000000\n") + 5}
+	go g.Send([]*output.Message{
+		{Field: "time", Metric: "avg", Value: "0.132", Time: tick},
+		{Field: "time", Metric: "max", Value: "0.500", Time: tick},
+		{Field: "code", Metric: "cps_200", Value: "10.000", Time: tick},
+	})
+
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	r := bufio.NewReader(conn)
+	for _, expected := range []string{
+		"web1.time.max 0.500 1500000000\n",
+		"web1.code.cps_200 10.000 1500000000\n",
+	} {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if line != expected {
+			t.Errorf("expected [%s] actual [%s]", expected, line)
+		}
+	}
+}
@@ -0,0 +1,300 @@
+package influxdb
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/blackbass1988/access_logs_stats/pkg/output"
+)
+
+const (
+	udpSafePackSize = 1432
+	httpTimeout     = 10 * time.Second
+)
+
+var (
+	measurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `)
+	keyEscaper         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+)
+
+//internalVars are vars which are set for key templates by output and template packages
+var internalVars = map[string]bool{"field": true, "metric": true, "group": true}
+
+type influxdb struct {
+	//url is an address of influxdb. http(s)://host:port or udp://host:port
+	url     *url.URL
+	version string
+
+	//v1 settings
+	database        string
+	retentionPolicy string
+	username        string
+	password        string
+
+	//v2 settings
+	org    string
+	bucket string
+	token  string
+
+	//template vars are common tags of every point
+	templateVars map[string]string
+
+	client *http.Client
+	conn   net.Conn
+
+	m sync.Mutex
+}
+
+//getLines returns one point per field. Metrics of field become fields of point
+func (i *influxdb) getLines(messages []*output.Message) [][]byte {
+	type point struct {
+		//series is measurement with tags
+		series   string
+		metrics  []string
+		unixTime int64
+	}
+
+	var (
+		points []*point
+		index  = make(map[string]*point)
+		lines  [][]byte
+	)
+
+	for _, message := range messages {
+		series := i.getSeries(message)
+		p, ok := index[series]
+		if !ok {
+			ts := message.Time
+			if ts.IsZero() {
+				ts = time.Now()
+			}
+			p = &point{series: series, unixTime: ts.Unix()}
+			index[series] = p
+			points = append(points, p)
+		}
+		p.metrics = append(p.metrics, keyEscaper.Replace(message.Metric)+"="+message.Value)
+	}
+
+	for _, p := range points {
+		lines = append(lines, []byte(fmt.Sprintf("%s %s %d\n", p.series, strings.Join(p.metrics, ","), p.unixTime)))
+	}
+
+	return lines
+}
+
+//getSeries returns measurement with tags: template vars, group labels and filter prefix.
+//Internal vars of key templates are not tags
+func (i *influxdb) getSeries(message *output.Message) string {
+	tags := make(map[string]string)
+	for _, vars := range []map[string]string{i.templateVars, message.Labels} {
+		for k, v := range vars {
+			if !internalVars[k] {
+				tags[k] = v
+			}
+		}
+	}
+	if message.Prefix != "" {
+		tags["filter"] = message.Prefix
+	}
+
+	return measurementEscaper.Replace(message.RawField) + getTags(tags)
+}
+
+//Send sends messages to influxdb
+func (i *influxdb) Send(messages []*output.Message) error {
+	lines := i.getLines(messages)
+	if len(lines) == 0 {
+		return nil
+	}
+
+	var err error
+	if i.url.Scheme == "udp" {
+		err = i.writeUDP(lines)
+	} else {
+		err = i.writeHTTP(bytes.Join(lines, nil))
+	}
+
+	if err != nil {
+		log.Println("influxdb write error:", err)
+		output.CountSendError("influxdb")
+	}
+	return err
+}
+
+func (i *influxdb) writeHTTP(body []byte) error {
+	req, err := http.NewRequest("POST", i.writeURL(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+
+	if i.token != "" {
+		req.Header.Set("Authorization", "Token "+i.token)
+	} else if i.username != "" {
+		req.SetBasicAuth(i.username, i.password)
+	}
+
+	resp, err := i.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		respBody, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("unexpected status %s: %s", resp.Status, strings.TrimSpace(string(respBody)))
+	}
+	return nil
+}
+
+func (i *influxdb) writeURL() string {
+	u := *i.url
+	q := url.Values{}
+	q.Set("precision", "s")
+
+	if i.version == "2" {
+		u.Path = strings.TrimRight(u.Path, "/") + "/api/v2/write"
+		q.Set("org", i.org)
+		q.Set("bucket", i.bucket)
+	} else {
+		u.Path = strings.TrimRight(u.Path, "/") + "/write"
+		q.Set("db", i.database)
+		if i.retentionPolicy != "" {
+			q.Set("rp", i.retentionPolicy)
+		}
+	}
+
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+func (i *influxdb) writeUDP(lines [][]byte) (err error) {
+	i.m.Lock()
+	defer i.m.Unlock()
+
+	if i.conn == nil {
+		i.conn, err = net.Dial("udp", i.url.Host)
+		if err != nil {
+			i.conn = nil
+			return err
+		}
+	}
+
+	//udp packet must contain only whole lines
+	buf := new(bytes.Buffer)
+	for _, line := range lines {
+		if buf.Len() > 0 && buf.Len()+len(line) > udpSafePackSize {
+			if _, err = i.conn.Write(buf.Bytes()); err != nil {
+				return err
+			}
+			buf.Reset()
+		}
+		buf.Write(line)
+	}
+	_, err = i.conn.Write(buf.Bytes())
+	return err
+}
+
+//Close closes udp socket
+func (i *influxdb) Close() error {
+	i.m.Lock()
+	defer i.m.Unlock()
+
+	if i.conn == nil {
+		return nil
+	}
+	err := i.conn.Close()
+	i.conn = nil
+	return err
+}
+
+//getTags returns escaped line protocol tags sorted by key
+func getTags(tags map[string]string) string {
+	keys := make([]string, 0, len(tags))
+	for k, v := range tags {
+		//empty tag values are not allowed by line protocol
+		if v != "" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	buf := new(bytes.Buffer)
+	for _, k := range keys {
+		buf.WriteString("," + keyEscaper.Replace(k) + "=" + keyEscaper.Replace(tags[k]))
+	}
+	return buf.String()
+}
+
+//New creates new influxdb sender
+func New(params map[string]string, templateVars map[string]string) (output.Target, error) {
+	var (
+		err    error
+		rawURL string
+	)
+
+	i := new(influxdb)
+	i.version = "1"
+	i.client = &http.Client{Timeout: httpTimeout}
+
+	for k, v := range params {
+		switch k {
+		case "url":
+			rawURL = v
+		case "version":
+			i.version = v
+		case "database":
+			i.database = v
+		case "retention_policy":
+			i.retentionPolicy = v
+		case "username":
+			i.username = v
+		case "password":
+			i.password = v
+		case "org":
+			i.org = v
+		case "bucket":
+			i.bucket = v
+		case "token":
+			i.token = v
+		}
+	}
+
+	i.templateVars = templateVars
+
+	i.url, err = url.Parse(rawURL)
+	if rawURL == "" || err != nil {
+		return nil, fmt.Errorf("influxdb settings is incorrect. You must specify valid url, was %s", rawURL)
+	}
+
+	switch {
+	case i.url.Scheme == "udp":
+	case i.url.Scheme != "http" && i.url.Scheme != "https":
+		err = errors.New("influxdb settings is incorrect. url scheme must be http, https or udp")
+	case i.version == "1" && i.database == "":
+		err = errors.New("influxdb settings is incorrect. You must specify database")
+	case i.version == "2" && (i.org == "" || i.bucket == ""):
+		err = errors.New("influxdb settings is incorrect. You must specify org and bucket")
+	case i.version != "1" && i.version != "2":
+		err = errors.New("influxdb settings is incorrect. version must be 1 or 2")
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	return i, nil
+}
+
+func init() {
+	output.RegisterOutput("influxdb", New)
+}
@@ -0,0 +1,124 @@
+package influxdb
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/blackbass1988/access_logs_stats/pkg/output"
+)
+
+var tick = time.Unix(1500000000, 0)
+
+var messages = []*output.Message{
+	{Field: "api_time", RawField: "time", Prefix: "api_", Metric: "avg", Value: "0.132", Time: tick},
+	{Field: "api_time", RawField: "time", Prefix: "api_", Metric: "cent_90", Value: "0.500", Time: tick},
+	{Field: "api_code", RawField: "code", Prefix: "api_", Metric: "cps_200", Value: "10.000", Time: tick},
+}
+
+const expectedBody = "time,filter=api_,host=web\\ 1 avg=0.132,cent_90=0.500 1500000000\n" +
+	"code,filter=api_,host=web\\ 1 cps_200=10.000 1500000000\n"
+
+type request struct {
+	path  string
+	query url.Values
+	auth  string
+	body  string
+}
+
+func newTestServer(t *testing.T, requests chan<- request) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		requests <- request{r.URL.Path, r.URL.Query(), r.Header.Get("Authorization"), string(body)}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+}
+
+func newTestInfluxdb(t *testing.T, rawURL string) *influxdb {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &influxdb{
+		url:          u,
+		client:       http.DefaultClient,
+		templateVars: map[string]string{"host": "web 1", "empty": ""},
+	}
+}
+
+func TestWriteV1(t *testing.T) {
+	requests := make(chan request, 1)
+	server := newTestServer(t, requests)
+	defer server.Close()
+
+	i := newTestInfluxdb(t, server.URL)
+	i.version = "1"
+	i.database = "stats"
+	i.username = "user"
+	i.password = "secret"
+
+	i.Send(messages)
+	r := <-requests
+
+	if r.path != "/write" {
+		t.Errorf("path expected /write actual %s", r.path)
+	}
+	if r.query.Get("db") != "stats" || r.query.Get("precision") != "s" {
+		t.Errorf("unexpected query %v", r.query)
+	}
+	if r.auth != "Basic dXNlcjpzZWNyZXQ=" {
+		t.Errorf("unexpected auth [%s]", r.auth)
+	}
+	if r.body != expectedBody {
+		t.Errorf("expected body:\n%s\nactual:\n%s", expectedBody, r.body)
+	}
+}
+
+func TestWriteV2(t *testing.T) {
+	requests := make(chan request, 1)
+	server := newTestServer(t, requests)
+	defer server.Close()
+
+	i := newTestInfluxdb(t, server.URL)
+	i.version = "2"
+	i.org = "org"
+	i.bucket = "bucket"
+	i.token = "token"
+
+	i.Send(messages)
+	r := <-requests
+
+	if r.path != "/api/v2/write" {
+		t.Errorf("path expected /api/v2/write actual %s", r.path)
+	}
+	if r.query.Get("org") != "org" || r.query.Get("bucket") != "bucket" {
+		t.Errorf("unexpected query %v", r.query)
+	}
+	if r.auth != "Token token" {
+		t.Errorf("unexpected auth [%s]", r.auth)
+	}
+	if r.body != expectedBody {
+		t.Errorf("expected body:\n%s\nactual:\n%s", expectedBody, r.body)
+	}
+}
+
+func TestSeriesTags(t *testing.T) {
+	i := newTestInfluxdb(t, "http://localhost:8086")
+
+	series := i.getSeries(&output.Message{
+		RawField: "time",
+		Metric:   "avg",
+		Labels:   map[string]string{"vhost": "api", "code": "200", "metric": "x"},
+	})
+
+	expected := "time,code=200,host=web\\ 1,vhost=api"
+	if series != expected {
+		t.Errorf("expected %s, actual %s", expected, series)
+	}
+}
@@ -1,34 +1,129 @@
 package output
 
-// default template if template for output not set
-const DefaultTemplate = "${field}.${metric}"
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
-type output struct {
-	name    string
-	send    func([]*Message)
-	init    func(map[string]string, map[string]string)
-	enabled bool
+	"github.com/blackbass1988/access_logs_stats/pkg/metrics"
+)
+
+// default template if template for output not set. ${group} makes keys of different groups of filter different
+const DefaultTemplate = "${field}${group}.${metric}"
+
+//LabelsTemplate is a default template of outputs which send labels as tags, so labels are not needed in key
+const LabelsTemplate = "${field}.${metric}"
+
+//Target is a configured instance of output. Every entry of "output" section has its own Target.
+//Implementations must be pointers because targets are compared in pool.
+//Send logs its errors itself, returned error only tells that messages were not delivered
+type Target interface {
+	Send(messages []*Message) error
 }
 
-var outputs = []output{}
+//Closer is implemented by targets which have to release connections on shutdown
+type Closer interface {
+	Close() error
+}
+
+//Factory creates new Target with given settings
+type Factory func(params map[string]string, templateVars map[string]string) (Target, error)
+
+var factories = map[string]Factory{}
 
 //Message is key=value presentation of calculation
 type Message struct {
+	//Field is a field name with filter prefix. It is used as ${field} in templates
 	Field  string
 	Metric string
 	Value  string
+
+	//Prefix is a prefix of filter which message belongs to
+	Prefix string
+	//RawField is a field name without filter prefix
+	RawField string
+
+	//Time is a time of period end which message was calculated for
+	Time time.Time
+
+	//Labels are values of filter's group_by fields. nil if filter has no group_by
+	Labels map[string]string
+
+	//Pipeline is a config of pipeline which message belongs to.
+	//Source is an Output which made message, it is unique in pipeline
+	Pipeline string
+	Source   string
 }
 
-//RegisterOutput registers new output
-func RegisterOutput(name string, send func(messages []*Message), init func(params map[string]string, templateVars map[string]string)) error {
-	outputs = append(outputs, output{name, send, init, false})
+//Vars returns templateVars with message labels and "group" var. Labels override template vars with the same name.
+//group is values of labels in order of label names, each one after ".", e.g. ".api.200". It is empty without labels
+func (m *Message) Vars(templateVars map[string]string) map[string]string {
+	vars := make(map[string]string, len(templateVars)+len(m.Labels)+1)
+	for k, v := range templateVars {
+		vars[k] = v
+	}
+
+	names := make([]string, 0, len(m.Labels))
+	for k, v := range m.Labels {
+		vars[k] = v
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var group strings.Builder
+	for _, name := range names {
+		group.WriteString(".")
+		group.WriteString(m.Labels[name])
+	}
+	vars["group"] = group.String()
+	return vars
+}
+
+//RegisterOutput registers factory of new output type
+func RegisterOutput(name string, factory Factory) error {
+	if _, ok := factories[name]; ok {
+		return fmt.Errorf("output \"%s\" already registered", name)
+	}
+	factories[name] = factory
 	return nil
 }
 
+//NewTarget creates new instance of output with type name
+func NewTarget(name string, params map[string]string, templateVars map[string]string) (Target, error) {
+	factory, ok := factories[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown output type: \"%s\"", name)
+	}
+
+	if params == nil {
+		params = make(map[string]string)
+	}
+
+	t, err := factory(params, templateVars)
+	if err != nil {
+		return nil, fmt.Errorf("output \"%s\": %s", name, err)
+	}
+	return t, nil
+}
+
 //Output is base struct of log target
 type Output struct {
+	pipeline string
+	source   string
 	prefix   string
+	time     time.Time
+	labels   map[string]string
 	messages []*Message
+	targets  []Target
+}
+
+//SetSource sets pipeline of output and name of output which is unique in pipeline. They are put into all messages
+func (s *Output) SetSource(pipeline string, source string) {
+	s.pipeline = pipeline
+	s.source = source
 }
 
 //SetPrefix sets common prefix for all keys
@@ -36,17 +131,34 @@ func (s *Output) SetPrefix(prefix string) {
 	s.prefix = prefix
 }
 
+//SetTime sets time of period for next messages
+func (s *Output) SetTime(t time.Time) {
+	s.time = t
+}
+
+//SetLabels sets labels of group for next messages
+func (s *Output) SetLabels(labels map[string]string) {
+	s.labels = labels
+}
+
 //AddMessage adds message to message pack
 func (s *Output) AddMessage(field string, metric string, value string) {
+	rawField := field
 
 	if len(s.prefix) > 0 {
 		field = s.prefix + field
 	}
 
 	m := new(Message)
+	m.Prefix = s.prefix
+	m.RawField = rawField
 	m.Field = field
 	m.Metric = metric
 	m.Value = value
+	m.Time = s.time
+	m.Labels = s.labels
+	m.Pipeline = s.pipeline
+	m.Source = s.source
 	s.messages = append(s.messages, m)
 }
 
@@ -54,21 +166,87 @@ func (s *Output) AddMessage(field string, metric string, value string) {
 func (s *Output) Send() {
 
 	currentMessages := s.messages
-	for _, aOutput := range outputs {
-		if aOutput.enabled {
-			aOutput.send(currentMessages)
-		}
+	for _, t := range s.targets {
+		//error is already logged by target
+		_ = t.Send(currentMessages)
 	}
 	s.messages = []*Message{}
 }
 
-//Init initializes parent outputs
-func (s *Output) Init(senderName string, params map[string]string, templateVars map[string]string) {
-	for i, aOutput := range outputs {
-		if aOutput.name == senderName {
-			outputs[i].enabled = true
-			aOutput.init(params, templateVars)
-			break
-		}
+//AddTarget adds target which will receive message packs
+func (s *Output) AddTarget(t Target) {
+	s.targets = append(s.targets, t)
+}
+
+//CountSendError counts failed sending of output type. Count is exposed as "output_send_errors" internal metric
+func CountSendError(outputType string) {
+	metrics.Default.Counter("output_send_errors", map[string]string{"output": outputType}).Inc()
+}
+
+//CloseTarget closes target if it implements Closer
+func CloseTarget(t Target) error {
+	if c, ok := t.(Closer); ok {
+		return c.Close()
 	}
+	return nil
+}
+
+type pooledTarget struct {
+	key  string
+	refs int
+}
+
+//pool of targets shared between pipelines with the same output settings
+var pool = struct {
+	sync.Mutex
+	byKey    map[string]Target
+	byTarget map[Target]*pooledTarget
+}{byKey: map[string]Target{}, byTarget: map[Target]*pooledTarget{}}
+
+//AcquireTarget returns shared instance of output with the same type, settings and template vars
+//or creates new one. Every acquired target must be released with ReleaseTarget
+func AcquireTarget(name string, params map[string]string, templateVars map[string]string) (Target, error) {
+	keyBytes, err := json.Marshal([]interface{}{name, params, templateVars})
+	if err != nil {
+		return nil, err
+	}
+	key := string(keyBytes)
+
+	pool.Lock()
+	defer pool.Unlock()
+
+	if t, ok := pool.byKey[key]; ok {
+		pool.byTarget[t].refs++
+		return t, nil
+	}
+
+	t, err := NewTarget(name, params, templateVars)
+	if err != nil {
+		return nil, err
+	}
+	pool.byKey[key] = t
+	pool.byTarget[t] = &pooledTarget{key: key, refs: 1}
+	return t, nil
+}
+
+//ReleaseTarget closes target acquired by AcquireTarget when it is not used anymore
+func ReleaseTarget(t Target) error {
+	pool.Lock()
+	p, ok := pool.byTarget[t]
+	if !ok {
+		pool.Unlock()
+		return CloseTarget(t)
+	}
+
+	p.refs--
+	if p.refs > 0 {
+		pool.Unlock()
+		return nil
+	}
+
+	delete(pool.byTarget, t)
+	delete(pool.byKey, p.key)
+	pool.Unlock()
+
+	return CloseTarget(t)
 }
@@ -0,0 +1,150 @@
+package output_test
+
+import (
+	"testing"
+
+	"github.com/blackbass1988/access_logs_stats/pkg/output"
+)
+
+type fakeTarget struct {
+	name     string
+	messages []*output.Message
+}
+
+func (f *fakeTarget) Send(messages []*output.Message) error {
+	f.messages = append(f.messages, messages...)
+	return nil
+}
+
+func init() {
+	output.RegisterOutput("fake", func(params map[string]string, templateVars map[string]string) (output.Target, error) {
+		return &fakeTarget{name: params["name"]}, nil
+	})
+}
+
+func TestRegisterTwice(t *testing.T) {
+	err := output.RegisterOutput("fake", nil)
+	if err == nil {
+		t.Error("second registration of the same type must fail")
+	}
+}
+
+func TestUnknownOutput(t *testing.T) {
+	if _, err := output.NewTarget("unknown", nil, nil); err == nil {
+		t.Error("unknown output type must fail")
+	}
+}
+
+func TestIndependentTargets(t *testing.T) {
+	prod, err := output.NewTarget("fake", map[string]string{"name": "prod"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	staging, err := output.NewTarget("fake", map[string]string{"name": "staging"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if prod.(*fakeTarget).name != "prod" || staging.(*fakeTarget).name != "staging" {
+		t.Errorf("targets must have own settings, was [%s] and [%s]",
+			prod.(*fakeTarget).name, staging.(*fakeTarget).name)
+	}
+
+	o := new(output.Output)
+	o.SetPrefix("api_")
+	o.AddTarget(prod)
+	o.AddMessage("time", "avg", "0.100")
+	o.Send()
+
+	if len(prod.(*fakeTarget).messages) != 1 {
+		t.Errorf("prod must receive 1 message, was %d", len(prod.(*fakeTarget).messages))
+	}
+
+	if len(staging.(*fakeTarget).messages) != 0 {
+		t.Errorf("staging must receive 0 messages, was %d", len(staging.(*fakeTarget).messages))
+	}
+
+	m := prod.(*fakeTarget).messages[0]
+	if m.Field != "api_time" || m.RawField != "time" || m.Prefix != "api_" {
+		t.Errorf("unexpected message %+v", m)
+	}
+}
+
+type closableTarget struct {
+	fakeTarget
+	closed int
+}
+
+func (c *closableTarget) Close() error {
+	c.closed++
+	return nil
+}
+
+func init() {
+	output.RegisterOutput("closable", func(params map[string]string, templateVars map[string]string) (output.Target, error) {
+		return &closableTarget{fakeTarget: fakeTarget{name: params["name"]}}, nil
+	})
+}
+
+func TestSharedTargets(t *testing.T) {
+	vars := map[string]string{"hostname": "web1"}
+
+	a, err := output.AcquireTarget("closable", map[string]string{"name": "prod"}, vars)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := output.AcquireTarget("closable", map[string]string{"name": "prod"}, vars)
+	c, _ := output.AcquireTarget("closable", map[string]string{"name": "staging"}, vars)
+
+	if a != b {
+		t.Error("targets with the same settings must be shared")
+	}
+	if a == c {
+		t.Error("targets with different settings must not be shared")
+	}
+
+	output.ReleaseTarget(a)
+	if a.(*closableTarget).closed != 0 {
+		t.Error("target must not be closed while it is used")
+	}
+
+	output.ReleaseTarget(b)
+	if a.(*closableTarget).closed != 1 {
+		t.Errorf("target must be closed once after last release, was closed %d times", a.(*closableTarget).closed)
+	}
+
+	output.ReleaseTarget(c)
+	if c.(*closableTarget).closed != 1 {
+		t.Error("target must be closed after release")
+	}
+}
+
+func TestMessageVars(t *testing.T) {
+	cases := []struct {
+		labels   map[string]string
+		expected map[string]string
+	}{
+		{nil, map[string]string{"host": "web1", "group": ""}},
+		{
+			map[string]string{"vhost": "api", "code": "200"},
+			map[string]string{"host": "web1", "vhost": "api", "code": "200", "group": ".200.api"},
+		},
+		{
+			map[string]string{"host": "web2"},
+			map[string]string{"host": "web2", "group": ".web2"},
+		},
+	}
+
+	for _, c := range cases {
+		vars := (&output.Message{Labels: c.labels}).Vars(map[string]string{"host": "web1"})
+		if len(vars) != len(c.expected) {
+			t.Errorf("labels %v: expected vars %v, actual %v", c.labels, c.expected, vars)
+			continue
+		}
+		for k, v := range c.expected {
+			if value, ok := vars[k]; !ok || value != v {
+				t.Errorf("labels %v: var %s expected %q, actual %q", c.labels, k, v, value)
+			}
+		}
+	}
+}
@@ -0,0 +1,274 @@
+package prometheus
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/blackbass1988/access_logs_stats/pkg/output"
+)
+
+const (
+	defaultNamespace = "access_logs_stats"
+	defaultPath      = "/metrics"
+	contentType      = "text/plain; version=0.0.4; charset=utf-8"
+)
+
+//pipelineLabel is added to all samples if target is shared by several pipelines. It is reserved like labels of filter and argument
+const pipelineLabel = "pipeline"
+
+//metrics with argument in name. cps_200 becomes {value="200"} and so on
+var argumentLabels = map[string]string{
+	"cps":        "value",
+	"percentage": "value",
+	"cent":       "cent",
+}
+
+type sample struct {
+	name     string
+	labels   [][2]string
+	value    string
+	pipeline string
+}
+
+type prometheus struct {
+	listen    string
+	path      string
+	namespace string
+
+	//samples of latest period by pipeline, source and filter prefix of messages. Every Send replaces samples
+	//of sources in it, so series of groups which are gone are not exposed anymore. Filters with the same prefix
+	//and pipelines which share target have different sources, so they don't replace samples of each other
+	samples map[string][]*sample
+
+	server *http.Server
+
+	m sync.Mutex
+}
+
+//Send stores messages for next scrape. Messages with values which are not numbers are skipped,
+//because they make exposition invalid
+func (p *prometheus) Send(messages []*output.Message) error {
+	bySource := make(map[string][]*sample)
+	for _, message := range messages {
+		key := message.Pipeline + "\x00" + message.Source + "\x00" + message.Prefix
+		samples := bySource[key]
+		if _, err := strconv.ParseFloat(message.Value, 64); err == nil {
+			samples = append(samples, p.newSample(message))
+		}
+		bySource[key] = samples
+	}
+
+	p.m.Lock()
+	for key, samples := range bySource {
+		p.samples[key] = samples
+	}
+	p.m.Unlock()
+	return nil
+}
+
+func (p *prometheus) newSample(message *output.Message) *sample {
+	s := new(sample)
+	s.pipeline = message.Pipeline
+
+	metric := message.Metric
+	parts := strings.SplitN(metric, "_", 2)
+	if label, ok := argumentLabels[parts[0]]; ok && len(parts) == 2 {
+		metric = parts[0]
+		s.labels = append(s.labels, [2]string{label, parts[1]})
+	}
+
+	if message.Prefix != "" {
+		s.labels = append(s.labels, [2]string{"filter", message.Prefix})
+	}
+
+	groupFields := make([]string, 0, len(message.Labels))
+	for k := range message.Labels {
+		groupFields = append(groupFields, k)
+	}
+	sort.Strings(groupFields)
+	for _, k := range groupFields {
+		s.labels = append(s.labels, [2]string{s.labelName(k), message.Labels[k]})
+	}
+	sort.Slice(s.labels, func(i, j int) bool { return s.labels[i][0] < s.labels[j][0] })
+
+	s.name = sanitizeName(p.namespace + "_" + message.RawField + "_" + metric)
+	s.value = message.Value
+	return s
+}
+
+//labelName returns label name of group field. Field which collides with existing or reserved label,
+//e.g. group_by field "filter", "value" or "pipeline", is renamed to "exported_" + name
+func (s *sample) labelName(field string) string {
+	name := sanitizeName(field)
+	for s.hasLabel(name) || name == pipelineLabel {
+		name = "exported_" + name
+	}
+	return name
+}
+
+func (s *sample) hasLabel(name string) bool {
+	for _, l := range s.labels {
+		if l[0] == name {
+			return true
+		}
+	}
+	return false
+}
+
+//key returns name and labels of sample. withPipeline adds pipeline label
+func (s *sample) key(withPipeline bool) string {
+	labels := s.labels
+	if withPipeline {
+		labels = append(labels[:len(labels):len(labels)], [2]string{pipelineLabel, s.pipeline})
+		sort.Slice(labels, func(i, j int) bool { return labels[i][0] < labels[j][0] })
+	}
+
+	buf := bytes.NewBufferString(s.name)
+	writeLabels(buf, labels)
+	return buf.String()
+}
+
+//write renders all samples in text exposition format. Samples get pipeline label if target is shared by pipelines
+func (p *prometheus) write(buf *bytes.Buffer) {
+	p.m.Lock()
+	pipelines := make(map[string]bool)
+	for _, samples := range p.samples {
+		for _, s := range samples {
+			pipelines[s.pipeline] = true
+		}
+	}
+
+	bySeries := make(map[string]*sample)
+	for _, samples := range p.samples {
+		for _, s := range samples {
+			bySeries[s.key(len(pipelines) > 1)] = s
+		}
+	}
+	p.m.Unlock()
+
+	//samples are sorted by name first, so samples of one metric are written together under one TYPE line
+	all := make([]*sample, 0, len(bySeries))
+	keys := make(map[*sample]string, len(bySeries))
+	for key, s := range bySeries {
+		all = append(all, s)
+		keys[s] = key
+	}
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].name != all[j].name {
+			return all[i].name < all[j].name
+		}
+		return keys[all[i]] < keys[all[j]]
+	})
+
+	prevName := ""
+	for _, s := range all {
+		if s.name != prevName {
+			fmt.Fprintf(buf, "# TYPE %s gauge\n", s.name)
+			prevName = s.name
+		}
+		buf.WriteString(keys[s])
+		buf.WriteByte(' ')
+		buf.WriteString(s.value)
+		buf.WriteByte('\n')
+	}
+}
+
+func (p *prometheus) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	buf := new(bytes.Buffer)
+	p.write(buf)
+	w.Header().Set("Content-Type", contentType)
+	w.Write(buf.Bytes())
+}
+
+//Close stops http listener
+func (p *prometheus) Close() error {
+	return p.server.Close()
+}
+
+func writeLabels(buf *bytes.Buffer, labels [][2]string) {
+	if len(labels) == 0 {
+		return
+	}
+	buf.WriteByte('{')
+	for i, l := range labels {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteString(sanitizeName(l[0]))
+		buf.WriteString(`="`)
+		buf.WriteString(escapeLabelValue(l[1]))
+		buf.WriteByte('"')
+	}
+	buf.WriteByte('}')
+}
+
+//sanitizeName replaces all chars not allowed in metric and label names with "_"
+func sanitizeName(name string) string {
+	b := []byte(name)
+	for i, c := range b {
+		isLetter := c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_' || c == ':'
+		isDigit := c >= '0' && c <= '9'
+		if !isLetter && !(isDigit && i > 0) {
+			b[i] = '_'
+		}
+	}
+	return string(b)
+}
+
+func escapeLabelValue(v string) string {
+	v = strings.Replace(v, `\`, `\\`, -1)
+	v = strings.Replace(v, "\n", `\n`, -1)
+	return strings.Replace(v, `"`, `\"`, -1)
+}
+
+//New creates prometheus output and starts http listener
+func New(params map[string]string, templateVars map[string]string) (output.Target, error) {
+	p := new(prometheus)
+	p.samples = make(map[string][]*sample)
+	p.path = defaultPath
+	p.namespace = defaultNamespace
+
+	for k, v := range params {
+		switch k {
+		case "listen":
+			p.listen = v
+		case "path":
+			p.path = v
+		case "namespace":
+			p.namespace = v
+		}
+	}
+
+	if p.listen == "" {
+		return nil, errors.New("prometheus settings is incorrect. You must specify listen")
+	}
+
+	l, err := net.Listen("tcp", p.listen)
+	if err != nil {
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(p.path, p)
+	p.server = &http.Server{Handler: mux}
+
+	go func() {
+		if err := p.server.Serve(l); err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+
+	return p, nil
+}
+
+func init() {
+	output.RegisterOutput("prometheus", New)
+}
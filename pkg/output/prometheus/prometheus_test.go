@@ -0,0 +1,159 @@
+package prometheus
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/blackbass1988/access_logs_stats/pkg/output"
+)
+
+func TestWrite(t *testing.T) {
+	p := &prometheus{namespace: "als", samples: make(map[string][]*sample)}
+
+	p.Send([]*output.Message{
+		{Field: "prefix2_code", RawField: "code", Prefix: "prefix2_", Metric: "cps_200", Value: "1.500"},
+		{Field: "prefix2_code", RawField: "code", Prefix: "prefix2_", Metric: "cps_500", Value: "0.100"},
+	})
+	p.Send([]*output.Message{
+		{Field: "time", RawField: "time", Metric: "cent_90", Value: "0.250"},
+		{Field: "time", RawField: "time", Metric: "sum_ps", Value: "3.000"},
+	})
+	//next period of filter replaces all its previous samples, other filters are kept
+	p.Send([]*output.Message{
+		{Field: "time", RawField: "time", Metric: "sum_ps", Value: "4.000"},
+	})
+
+	expected := `# TYPE als_code_cps gauge
+als_code_cps{filter="prefix2_",value="200"} 1.500
+als_code_cps{filter="prefix2_",value="500"} 0.100
+# TYPE als_time_sum_ps gauge
+als_time_sum_ps 4.000
+`
+	buf := new(bytes.Buffer)
+	p.write(buf)
+
+	if buf.String() != expected {
+		t.Errorf("expected:\n%s\nactual:\n%s", expected, buf.String())
+	}
+}
+
+func TestWriteOneTypePerMetric(t *testing.T) {
+	p := &prometheus{namespace: "als", samples: make(map[string][]*sample)}
+
+	p.Send([]*output.Message{
+		{Field: "time", RawField: "time", Metric: "sum", Value: "3.000"},
+		{Field: "time", RawField: "time", Metric: "sum_ps", Value: "1.000"},
+	})
+	p.Send([]*output.Message{
+		{Field: "p_time", RawField: "time", Prefix: "p_", Metric: "sum", Value: "6.000"},
+	})
+
+	expected := `# TYPE als_time_sum gauge
+als_time_sum 3.000
+als_time_sum{filter="p_"} 6.000
+# TYPE als_time_sum_ps gauge
+als_time_sum_ps 1.000
+`
+	buf := new(bytes.Buffer)
+	p.write(buf)
+
+	if buf.String() != expected {
+		t.Errorf("expected:\n%s\nactual:\n%s", expected, buf.String())
+	}
+}
+
+func TestGroupLabelCollision(t *testing.T) {
+	p := &prometheus{namespace: "als", samples: make(map[string][]*sample)}
+
+	s := p.newSample(&output.Message{
+		RawField: "code",
+		Prefix:   "p_",
+		Metric:   "cps_200",
+		Value:    "1",
+		Labels:   map[string]string{"filter": "a", "value": "b", "vhost": "c"},
+	})
+
+	expected := `als_code_cps{exported_filter="a",exported_value="b",filter="p_",value="200",vhost="c"}`
+	if s.key(false) != expected {
+		t.Errorf("expected %s, actual %s", expected, s.key(false))
+	}
+}
+
+func TestSanitizeName(t *testing.T) {
+	var tests = map[string]string{
+		"foo_bar":       "foo_bar",
+		"foo.bar-baz":   "foo_bar_baz",
+		"1foo":          "_foo",
+		"als_upstream1": "als_upstream1",
+	}
+
+	for in, expected := range tests {
+		if actual := sanitizeName(in); actual != expected {
+			t.Errorf("sanitizeName(%s) expected [%s] actual [%s]", in, expected, actual)
+		}
+	}
+}
+
+func TestWriteSources(t *testing.T) {
+	p := &prometheus{namespace: "als", samples: make(map[string][]*sample)}
+
+	//two filters of one pipeline with the same prefix
+	p.Send([]*output.Message{
+		{Field: "code", RawField: "code", Metric: "cps_200", Value: "1.000", Pipeline: "api.yaml", Source: "filter 0"},
+	})
+	p.Send([]*output.Message{
+		{Field: "time", RawField: "time", Metric: "avg", Value: "0.100", Pipeline: "api.yaml", Source: "filter 1"},
+	})
+
+	expected := `# TYPE als_code_cps gauge
+als_code_cps{value="200"} 1.000
+# TYPE als_time_avg gauge
+als_time_avg 0.100
+`
+	buf := new(bytes.Buffer)
+	p.write(buf)
+	if buf.String() != expected {
+		t.Errorf("expected:\n%s\nactual:\n%s", expected, buf.String())
+	}
+
+	//other pipeline shares target
+	p.Send([]*output.Message{
+		{Field: "time", RawField: "time", Metric: "avg", Value: "0.200", Pipeline: "static.yaml", Source: "filter 0",
+			Labels: map[string]string{"pipeline": "x"}},
+	})
+
+	expected = `# TYPE als_code_cps gauge
+als_code_cps{pipeline="api.yaml",value="200"} 1.000
+# TYPE als_time_avg gauge
+als_time_avg{exported_pipeline="x",pipeline="static.yaml"} 0.200
+als_time_avg{pipeline="api.yaml"} 0.100
+`
+	buf.Reset()
+	p.write(buf)
+	if buf.String() != expected {
+		t.Errorf("expected:\n%s\nactual:\n%s", expected, buf.String())
+	}
+}
+
+func TestSkipInvalidValues(t *testing.T) {
+	p := &prometheus{namespace: "als", samples: make(map[string][]*sample)}
+
+	p.Send([]*output.Message{
+		{Field: "time", RawField: "time", Metric: "avg", Value: "0.100"},
+		{Field: "time", RawField: "time", Metric: "max", Value: "1.000"},
+	})
+	p.Send([]*output.Message{
+		{Field: "time", RawField: "time", Metric: "avg", Value: ""},
+		{Field: "time", RawField: "time", Metric: "max", Value: "-"},
+		{Field: "time", RawField: "time", Metric: "min", Value: "NaN"},
+	})
+
+	expected := `# TYPE als_time_min gauge
+als_time_min NaN
+`
+	buf := new(bytes.Buffer)
+	p.write(buf)
+	if buf.String() != expected {
+		t.Errorf("expected:\n%s\nactual:\n%s", expected, buf.String())
+	}
+}
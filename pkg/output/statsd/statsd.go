@@ -0,0 +1,204 @@
+package statsd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/blackbass1988/access_logs_stats/pkg/output"
+	"github.com/blackbass1988/access_logs_stats/pkg/template"
+)
+
+const defaultMtu = 1432
+
+type statsd struct {
+	statsdHost string
+	statsdPort string
+	mtu        int
+
+	//dogstatsd enables "|#tag:value" suffix
+	dogstatsd bool
+	tags      []string
+
+	template     *template.Template
+	templateVars map[string]string
+
+	conn net.Conn
+
+	m sync.Mutex
+}
+
+//getPackets returns gauges joined to packets not greater than mtu
+func (s *statsd) getPackets(messages []*output.Message) [][]byte {
+	var (
+		packets [][]byte
+		buf     = new(bytes.Buffer)
+	)
+
+	for _, message := range messages {
+		err, key := s.template.Process(message.Field, message.Metric, message.Vars(s.templateVars))
+
+		if err != nil {
+			log.Println("statsd template error:", err)
+			output.CountSendError("statsd")
+			continue
+		}
+
+		line := s.getLine(key, message)
+
+		if buf.Len() > 0 && buf.Len()+1+len(line) > s.mtu {
+			packets = append(packets, append([]byte{}, buf.Bytes()...))
+			buf.Reset()
+		}
+		if buf.Len() > 0 {
+			buf.WriteByte('\n')
+		}
+		buf.WriteString(line)
+	}
+
+	if buf.Len() > 0 {
+		packets = append(packets, buf.Bytes())
+	}
+	return packets
+}
+
+func (s *statsd) getLine(key string, message *output.Message) string {
+	line := sanitize(key) + ":" + message.Value + "|g"
+
+	if !s.dogstatsd {
+		return line
+	}
+
+	tags := s.tags[:len(s.tags):len(s.tags)]
+	if message.Prefix != "" {
+		tags = append(tags, "filter:"+sanitize(message.Prefix))
+	}
+
+	labels := make([]string, 0, len(message.Labels))
+	for k, v := range message.Labels {
+		labels = append(labels, sanitize(k)+":"+sanitize(v))
+	}
+	sort.Strings(labels)
+	tags = append(tags, labels...)
+
+	if len(tags) > 0 {
+		line += "|#" + strings.Join(tags, ",")
+	}
+	return line
+}
+
+//Send sends messages to statsd
+func (s *statsd) Send(messages []*output.Message) (err error) {
+	packets := s.getPackets(messages)
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if s.conn == nil {
+		s.conn, err = net.Dial("udp", net.JoinHostPort(s.statsdHost, s.statsdPort))
+		if err != nil {
+			s.conn = nil
+			log.Println("statsd connect error:", err)
+			output.CountSendError("statsd")
+			return err
+		}
+	}
+
+	for _, packet := range packets {
+		if _, e := s.conn.Write(packet); e != nil {
+			log.Println("statsd write error:", e)
+			output.CountSendError("statsd")
+			err = e
+		}
+	}
+	return err
+}
+
+//Close closes udp socket
+func (s *statsd) Close() error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+//sanitize replaces chars reserved by statsd protocol
+func sanitize(v string) string {
+	return strings.NewReplacer(":", "_", "|", "_", "@", "_", "#", "_", ",", "_", " ", "_", "\n", "_").Replace(v)
+}
+
+//New creates new statsd sender
+func New(params map[string]string, templateVars map[string]string) (output.Target, error) {
+	var err error
+
+	s := new(statsd)
+	s.templateVars = templateVars
+	s.mtu = defaultMtu
+	templateString := ""
+
+	for k, v := range params {
+		switch k {
+		case "statsd_host":
+			s.statsdHost = v
+		case "statsd_port":
+			s.statsdPort = v
+		case "mtu":
+			s.mtu, err = strconv.Atoi(v)
+			if err != nil || s.mtu <= 0 {
+				return nil, fmt.Errorf("statsd settings is incorrect. mtu must be positive integer, was %s", v)
+			}
+		case "dogstatsd":
+			s.dogstatsd = v == "true"
+		case "tags":
+			err, tmpl := template.NewTempate(v)
+			if err == nil {
+				err, v = tmpl.ProcessTemplate(templateVars)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("invalid tags %s error was: %s", v, err)
+			}
+			for _, tag := range strings.Split(v, ",") {
+				if tag = strings.TrimSpace(tag); tag != "" {
+					s.tags = append(s.tags, tag)
+				}
+			}
+		case "template":
+			templateString = v
+		}
+	}
+
+	if templateString == "" {
+		//dogstatsd sends labels as tags
+		templateString = output.DefaultTemplate
+		if s.dogstatsd {
+			templateString = output.LabelsTemplate
+		}
+	}
+
+	err, s.template = template.NewTempate(templateString)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template %s error was: %s", templateString, err)
+	}
+
+	if s.statsdHost == "" || s.statsdPort == "" {
+		return nil, errors.New("statsd settings is incorrect. You must specify " +
+			"statsd_host and statsd_port")
+	}
+
+	return s, nil
+}
+
+func init() {
+	output.RegisterOutput("statsd", New)
+}
@@ -0,0 +1,88 @@
+package statsd
+
+import (
+	"testing"
+
+	"github.com/blackbass1988/access_logs_stats/pkg/output"
+	"github.com/blackbass1988/access_logs_stats/pkg/template"
+)
+
+func newTestStatsd(mtu int, dogstatsd bool) *statsd {
+	_, tmpl := template.NewTempate(output.DefaultTemplate)
+	return &statsd{
+		mtu:       mtu,
+		dogstatsd: dogstatsd,
+		tags:      []string{"host:web1"},
+		template:  tmpl,
+	}
+}
+
+func TestPackets(t *testing.T) {
+	st := newTestStatsd(40, false)
+
+	packets := st.getPackets([]*output.Message{
+		{Field: "time", Metric: "avg", Value: "0.132"},
+		{Field: "time", Metric: "max", Value: "1.000"},
+		{Field: "code", Metric: "cps_200", Value: "10.000"},
+	})
+
+	expected := []string{
+		"time.avg:0.132|g\ntime.max:1.000|g",
+		"code.cps_200:10.000|g",
+	}
+
+	if len(packets) != len(expected) {
+		t.Fatalf("expected %d packets actual %d", len(expected), len(packets))
+	}
+
+	for i, p := range packets {
+		if string(p) != expected[i] {
+			t.Errorf("packet %d expected [%s] actual [%s]", i, expected[i], p)
+		}
+		if len(p) > st.mtu {
+			t.Errorf("packet %d is greater than mtu: %d", i, len(p))
+		}
+	}
+}
+
+func TestDogStatsdTags(t *testing.T) {
+	st := newTestStatsd(defaultMtu, true)
+
+	packets := st.getPackets([]*output.Message{
+		{Field: "api_time", RawField: "time", Prefix: "api_", Metric: "avg", Value: "0.132"},
+		{Field: "time", RawField: "time", Metric: "max", Value: "1.000"},
+	})
+
+	expected := "api_time.avg:0.132|g|#host:web1,filter:api_\ntime.max:1.000|g|#host:web1"
+	if actual := string(packets[0]); actual != expected {
+		t.Errorf("expected [%s] actual [%s]", expected, actual)
+	}
+
+	if len(st.tags) != 1 {
+		t.Error("filter tag must not be appended to common tags: ", st.tags)
+	}
+}
+
+func TestDefaultTemplate(t *testing.T) {
+	message := &output.Message{Field: "time", Metric: "avg", Value: "0.132", Labels: map[string]string{"vhost": "api"}}
+
+	cases := []struct {
+		dogstatsd string
+		expected  string
+	}{
+		{"false", "time.api.avg:0.132|g"},
+		{"true", "time.avg:0.132|g|#vhost:api"},
+	}
+
+	for _, c := range cases {
+		target, err := New(map[string]string{"statsd_host": "localhost", "statsd_port": "8125", "dogstatsd": c.dogstatsd}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		packets := target.(*statsd).getPackets([]*output.Message{message})
+		if len(packets) != 1 || string(packets[0]) != c.expected {
+			t.Errorf("dogstatsd %s: expected [%s] actual %q", c.dogstatsd, c.expected, packets)
+		}
+	}
+}
@@ -4,19 +4,21 @@ import (
 	"bytes"
 	"encoding/binary"
 	"encoding/json"
-	"io"
+	"errors"
+	"fmt"
+	"io/ioutil"
 	"log"
 	"net"
 	"os"
+	"regexp"
+	"strconv"
 
+	"github.com/blackbass1988/access_logs_stats/pkg/metrics"
 	"github.com/blackbass1988/access_logs_stats/pkg/output"
 	"github.com/blackbass1988/access_logs_stats/pkg/template"
 )
 
-var (
-	z      *zabbix
-	header = []byte("ZBXD\x01")
-)
+var header = []byte("ZBXD\x01")
 
 //@link https://www.zabbix.org/wiki/Docs/protocols/zabbix_sender/2.0
 type message struct {
@@ -46,7 +48,7 @@ func (z *zabbix) getData(messages []*output.Message) []data {
 	for _, message := range messages {
 		key := message.Field + "_" + message.Metric
 
-		err, key := z.template.Process(message.Field, message.Metric, z.templateVars)
+		err, key := z.template.Process(message.Field, message.Metric, message.Vars(z.templateVars))
 
 		if err != nil {
 			//ok for dev version
@@ -59,7 +61,8 @@ func (z *zabbix) getData(messages []*output.Message) []data {
 	return els
 }
 
-func (z *zabbix) send(messages []*output.Message) {
+//Send sends messages to zabbix
+func (z *zabbix) Send(messages []*output.Message) error {
 	//todo refact
 	//todo persist connect?
 
@@ -70,14 +73,16 @@ func (z *zabbix) send(messages []*output.Message) {
 	jsonBytes, err := json.Marshal(m)
 	if err != nil {
 		log.Println("json marshal error:", err)
-		return
+		output.CountSendError("zabbix")
+		return err
 	}
 
 	//send to server
 	conn, err := net.Dial("tcp4", z.zabbixHost+":"+z.zabbixPort)
 	if err != nil {
 		log.Println("zabbix connect error:", err)
-		return
+		output.CountSendError("zabbix")
+		return err
 	}
 	defer conn.Close()
 
@@ -89,37 +94,70 @@ func (z *zabbix) send(messages []*output.Message) {
 	_, err = conn.Write(buf.Bytes())
 	if err != nil {
 		log.Println("zabbix socket write error:", err)
+		output.CountSendError("zabbix")
+		return err
 	}
 
-	//read response
-	response := []byte{}
-	tmp := make([]byte, 64)
-	for {
-		_, err := conn.Read(tmp)
-		if err != nil {
-			if err != io.EOF {
-				log.Print("zabbix socket read error:", err)
-			}
-			break
-		}
-		response = append(response, tmp...)
+	//read response. Server closes connection after it
+	response, err := ioutil.ReadAll(conn)
+	if err != nil {
+		log.Print("zabbix socket read error:", err)
+		output.CountSendError("zabbix")
+		return err
 	}
 
-	//if failed - > log it!
-	//log.Println(string(buf.Bytes()))
-	//log.Println(string(response))
+	processed, failed, err := parseResponse(response)
+	if err != nil {
+		log.Println("zabbix response error:", err)
+		output.CountSendError("zabbix")
+		return err
+	}
+
+	labels := map[string]string{"server": z.zabbixHost + ":" + z.zabbixPort}
+	metrics.Default.Counter("zabbix_processed", labels).Add(processed)
+	metrics.Default.Counter("zabbix_failed", labels).Add(failed)
 
+	if failed > 0 {
+		log.Printf("zabbix failed to process %d of %d items\n", failed, processed+failed)
+	}
+	return nil
 }
 
-//Send sends messages to zabbix
-func Send(messages []*output.Message) {
-	z.send(messages)
+var infoRex = regexp.MustCompile(`(?i)processed:? (\d+);? failed:? (\d+)`)
+
+//parseResponse returns counts of processed and failed items from zabbix server response
+func parseResponse(response []byte) (processed uint64, failed uint64, err error) {
+	if len(response) < len(header)+8 || !bytes.HasPrefix(response, header) {
+		return 0, 0, fmt.Errorf("invalid response %q", response)
+	}
+
+	var r struct {
+		Response string `json:"response"`
+		Info     string `json:"info"`
+	}
+	if err = json.Unmarshal(response[len(header)+8:], &r); err != nil {
+		return 0, 0, err
+	}
+
+	if r.Response != "success" {
+		return 0, 0, fmt.Errorf("response \"%s\", info \"%s\"", r.Response, r.Info)
+	}
+
+	matches := infoRex.FindStringSubmatch(r.Info)
+	if matches == nil {
+		return 0, 0, fmt.Errorf("unknown info \"%s\"", r.Info)
+	}
+
+	processed, _ = strconv.ParseUint(matches[1], 10, 64)
+	failed, _ = strconv.ParseUint(matches[2], 10, 64)
+	return processed, failed, nil
 }
 
-//Init initializes zabbix sender
-func Init(params map[string]string, templateVars map[string]string) {
+//New creates new zabbix sender
+func New(params map[string]string, templateVars map[string]string) (output.Target, error) {
 	var err error
 
+	z := new(zabbix)
 	z.templateVars = templateVars
 	templateString := output.DefaultTemplate
 
@@ -142,16 +180,17 @@ func Init(params map[string]string, templateVars map[string]string) {
 
 	err, z.template = template.NewTempate(templateString)
 	if err != nil {
-		log.Fatalln("invalid template", templateString, "error was:", err)
+		return nil, fmt.Errorf("invalid template %s error was: %s", templateString, err)
 	}
 
 	if z.zabbixHost == "" || z.zabbixPort == "" || z.host == "" {
-		log.Fatal("zabbix settings is incorrect. You must specify ",
+		return nil, errors.New("zabbix settings is incorrect. You must specify " +
 			"zabbix_host, zabbix_port and host")
 	}
+
+	return z, nil
 }
 
 func init() {
-	z = new(zabbix)
-	output.RegisterOutput("zabbix", Send, Init)
+	output.RegisterOutput("zabbix", New)
 }
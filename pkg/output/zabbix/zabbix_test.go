@@ -0,0 +1,36 @@
+package zabbix
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func response(body string) []byte {
+	buf := bytes.NewBuffer(append([]byte{}, header...))
+	binary.Write(buf, binary.LittleEndian, uint64(len(body)))
+	buf.WriteString(body)
+	return buf.Bytes()
+}
+
+func TestParseResponse(t *testing.T) {
+	processed, failed, err := parseResponse(response(
+		`{"response":"success","info":"processed: 7; failed: 2; total: 9; seconds spent: 0.000055"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if processed != 7 || failed != 2 {
+		t.Errorf("expected 7 processed and 2 failed, actual %d and %d", processed, failed)
+	}
+
+	for _, bad := range [][]byte{
+		[]byte("garbage"),
+		response(`{"response":"failed","info":"processed: 0; failed: 1"}`),
+		response(`{"response":"success","info":"unknown"}`),
+		response(`not json`),
+	} {
+		if _, _, err := parseResponse(bad); err == nil {
+			t.Errorf("response %q must fail", bad)
+		}
+	}
+}
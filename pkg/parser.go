@@ -0,0 +1,208 @@
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/blackbass1988/access_logs_stats/pkg/re"
+)
+
+//Parser makes RowEntry from input line. It returns errEmptyResult if line can't be parsed
+type Parser interface {
+	Parse(rawString string) (*RowEntry, error)
+}
+
+//parsers contains parsers by "parser" config value. regexp parser is created by newParser from regexp of config
+var parsers = map[string]Parser{
+	"json":   jsonParser{},
+	"logfmt": logfmtParser{},
+	"ltsv":   ltsvParser{},
+}
+
+//FormatField is a name of field which contains format of regexp matched the row
+const FormatField = "format"
+
+//FileField is a name of field which contains path of file the row was read from by file input.
+//Field of the same name parsed from the row is not replaced
+const FileField = "file"
+
+//RegexpFormat is an element of "regexp" list of config
+type RegexpFormat struct {
+	Rex re.RegExp
+	//Format is put into FormatField of rows matched Rex if it is not empty
+	Format string
+}
+
+//newParser returns parser by name of "parser" config. regexp parser is default
+func newParser(name string, regexps []RegexpFormat) (Parser, error) {
+	if name == "" || name == "regexp" {
+		return regexpParser{regexps}, nil
+	}
+
+	if p, ok := parsers[name]; ok {
+		return p, nil
+	}
+	return nil, fmt.Errorf("unknown parser \"%s\"", name)
+}
+
+//regexpParser tries regexps in order, the first matched one wins
+type regexpParser struct {
+	regexps []RegexpFormat
+}
+
+func (p regexpParser) Parse(rawString string) (*RowEntry, error) {
+	for _, r := range p.regexps {
+		row, err := NewRow(rawString, r.Rex)
+		if err == errEmptyResult {
+			continue
+		}
+		if err == nil && r.Format != "" {
+			row.Fields[FormatField] = r.Format
+		}
+		return row, err
+	}
+	return nil, errEmptyResult
+}
+
+//jsonParser parses JSON objects. Keys of nested objects are joined with ".": {"a":{"b":1}} -> a.b.
+//Numbers are kept in RowEntry.Numbers, so aggregates don't parse them again
+type jsonParser struct{}
+
+func (p jsonParser) Parse(rawString string) (*RowEntry, error) {
+	var object map[string]interface{}
+
+	decoder := json.NewDecoder(strings.NewReader(rawString))
+	decoder.UseNumber()
+	if err := decoder.Decode(&object); err != nil || object == nil {
+		return nil, errEmptyResult
+	}
+
+	row := new(RowEntry)
+	row.Raw = rawString
+	row.Fields = make(map[string]string)
+	row.Numbers = make(map[string]float64)
+
+	flattenJSON(row, "", object)
+	return row, nil
+}
+
+func flattenJSON(row *RowEntry, key string, value interface{}) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for k, nested := range v {
+			if key != "" {
+				k = key + "." + k
+			}
+			flattenJSON(row, k, nested)
+		}
+	case []interface{}:
+		for i, nested := range v {
+			flattenJSON(row, key+"."+strconv.Itoa(i), nested)
+		}
+	case json.Number:
+		row.Fields[key] = v.String()
+		if f, err := v.Float64(); err == nil {
+			row.Numbers[key] = f
+		}
+	case string:
+		row.Fields[key] = v
+	case bool:
+		row.Fields[key] = strconv.FormatBool(v)
+	case nil:
+		//null fields are absent
+	}
+}
+
+//logfmtParser parses key=value key2="quoted value" lines. Key without value gets empty value
+type logfmtParser struct{}
+
+func (p logfmtParser) Parse(rawString string) (*RowEntry, error) {
+	row := new(RowEntry)
+	row.Raw = rawString
+	row.Fields = make(map[string]string)
+
+	for i := 0; i < len(rawString); {
+		if rawString[i] <= ' ' {
+			i++
+			continue
+		}
+
+		start := i
+		for i < len(rawString) && rawString[i] > ' ' && rawString[i] != '=' && rawString[i] != '"' {
+			i++
+		}
+		key := rawString[start:i]
+		if key == "" {
+			return nil, errEmptyResult
+		}
+
+		if i == len(rawString) || rawString[i] != '=' {
+			row.Fields[key] = ""
+			continue
+		}
+		i++
+
+		if i < len(rawString) && rawString[i] == '"' {
+			value, n, err := unquoteLogfmt(rawString[i:])
+			if err != nil {
+				return nil, errEmptyResult
+			}
+			row.Fields[key] = value
+			i += n
+			continue
+		}
+
+		start = i
+		for i < len(rawString) && rawString[i] > ' ' {
+			i++
+		}
+		row.Fields[key] = rawString[start:i]
+	}
+
+	if len(row.Fields) == 0 {
+		return nil, errEmptyResult
+	}
+	return row, nil
+}
+
+//unquoteLogfmt returns value of quoted string at the beginning of s and its length with quotes
+func unquoteLogfmt(s string) (string, int, error) {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			value, err := strconv.Unquote(s[:i+1])
+			return value, i + 1, err
+		}
+	}
+	return "", 0, errEmptyResult
+}
+
+//ltsvParser parses label:value<TAB>label2:value lines
+type ltsvParser struct{}
+
+func (p ltsvParser) Parse(rawString string) (*RowEntry, error) {
+	row := new(RowEntry)
+	row.Raw = rawString
+	row.Fields = make(map[string]string)
+
+	for _, field := range strings.Split(strings.TrimRight(rawString, "\r\n"), "\t") {
+		if field == "" {
+			continue
+		}
+
+		i := strings.IndexByte(field, ':')
+		if i <= 0 {
+			return nil, errEmptyResult
+		}
+		row.Fields[field[:i]] = field[i+1:]
+	}
+
+	if len(row.Fields) == 0 {
+		return nil, errEmptyResult
+	}
+	return row, nil
+}
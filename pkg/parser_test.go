@@ -0,0 +1,121 @@
+package pkg
+
+import (
+	"testing"
+)
+
+func TestParsers(t *testing.T) {
+	cases := []struct {
+		parser   string
+		line     string
+		expected map[string]string
+	}{
+		{
+			"json",
+			`{"status": 200, "request_time": 0.015, "vhost": "api", "upstream": {"addr": "10.0.0.1:80", "tries": [1, 2]}, "cached": false, "referer": null}`,
+			map[string]string{
+				"status":           "200",
+				"request_time":     "0.015",
+				"vhost":            "api",
+				"upstream.addr":    "10.0.0.1:80",
+				"upstream.tries.0": "1",
+				"upstream.tries.1": "2",
+				"cached":           "false",
+			},
+		},
+		{
+			"logfmt",
+			`level=info msg="request done \"ok\"" status=200 duration=0.015 path=/api/v1?a=b cached empty=`,
+			map[string]string{
+				"level":    "info",
+				"msg":      `request done "ok"`,
+				"status":   "200",
+				"duration": "0.015",
+				"path":     "/api/v1?a=b",
+				"cached":   "",
+				"empty":    "",
+			},
+		},
+		{
+			"ltsv",
+			"host:127.0.0.1\ttime:[18/Oct/2026:10:00:00 +0300]\treq:GET /a:b HTTP/1.1\tstatus:200\tua:\n",
+			map[string]string{
+				"host":   "127.0.0.1",
+				"time":   "[18/Oct/2026:10:00:00 +0300]",
+				"req":    "GET /a:b HTTP/1.1",
+				"status": "200",
+				"ua":     "",
+			},
+		},
+	}
+
+	for _, c := range cases {
+		p, err := newParser(c.parser, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		row, err := p.Parse(c.line)
+		if err != nil {
+			t.Errorf("%s: %s", c.parser, err)
+			continue
+		}
+
+		if len(row.Fields) != len(c.expected) {
+			t.Errorf("%s: expected fields %v, actual %v", c.parser, c.expected, row.Fields)
+		}
+		for k, v := range c.expected {
+			if value, ok := row.Fields[k]; !ok || value != v {
+				t.Errorf("%s: field %s expected %s, actual %s", c.parser, k, v, value)
+			}
+		}
+	}
+}
+
+func TestParserErrors(t *testing.T) {
+	cases := []struct {
+		parser string
+		lines  []string
+	}{
+		{"json", []string{"", "not json", `[1, 2]`, `null`, `{"status": `}},
+		{"logfmt", []string{"", "   ", `msg="unterminated`, `="value"`}},
+		{"ltsv", []string{"", "no labels here", "host:a\tbroken"}},
+	}
+
+	for _, c := range cases {
+		p, err := newParser(c.parser, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, line := range c.lines {
+			if _, err := p.Parse(line); err == nil {
+				t.Errorf("%s: line %q must not be parsed", c.parser, line)
+			}
+		}
+	}
+
+	if _, err := newParser("xml", nil); err == nil {
+		t.Error("unknown parser must fail")
+	}
+}
+
+func TestJSONParserNumbers(t *testing.T) {
+	raw := `{"status": 200, "request_time": 0.015, "vhost": "api"}`
+	row, err := jsonParser{}.Parse(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if row.Numbers["request_time"] != 0.015 || row.Numbers["status"] != 200 {
+		t.Errorf("incorrect numbers %v", row.Numbers)
+	}
+
+	if _, ok := row.Numbers["vhost"]; ok {
+		t.Error("string field must not be in numbers")
+	}
+
+	if row.Raw != raw {
+		t.Errorf("expected raw %s, actual %s", raw, row.Raw)
+	}
+}
@@ -1,11 +1,18 @@
+//go:build !nopcre
+// +build !nopcre
+
 package re
 
 import (
 	"errors"
 	"github.com/glenn-brown/golang-pkg-pcre/src/pkg/pcre"
-	"regexp"
 )
 
+func init() {
+	engines[EnginePcre] = newLibPcreRegexp
+	defaultEngine = EnginePcre
+}
+
 //LibPcreRegexp implements RegExp interface with libcre
 type LibPcreRegexp struct {
 	RegExp
@@ -58,21 +65,3 @@ func (n *LibPcreRegexp) MatchString(s string) bool {
 func (n *LibPcreRegexp) String() string {
 	return n.expr
 }
-
-func getNamedGroupsFromExpression(expr string) []string {
-	//collect named groups from expression.
-	r, err := regexp.Compile(`\?P<([^>]+)>`)
-	if err != nil {
-		panic(err)
-	}
-
-	matches := r.FindAllStringSubmatch(expr, -1)
-
-	namedGroups := make([]string, len(matches)+1)
-
-	for i, m := range matches {
-		namedGroups[i+1] = m[1]
-	}
-
-	return namedGroups
-}
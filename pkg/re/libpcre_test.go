@@ -0,0 +1,58 @@
+//go:build !nopcre
+// +build !nopcre
+
+package re
+
+import "testing"
+
+var inputString = `s.auto.drom.ru s.auto.drom.ru 217.118.78.99 - [2017-03-19T20:57:44+10:00] GET "/i24204/r/photos/249454/gen177_1119983.jpg" HTTP/1.1 200 9453 "http://www.drom.ru/" "Mozilla/5.0 (Linux; Android 4.4.4; SM-T116 Build/KTU84P) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/48.0.2564.95 Safari/537.36" 0.200 717 "-" "-" HIT "-/" bad75053zRkT2GgTtk25FGYmFoYnw0a7 -`
+
+//very slow in libpcre and fast in regexp
+var expression = `HTTP/\d.?\d?\s(?P<code>\d+)[^"]+"[^"]*" "[^"]*" (?P<time>\d{1,}\.\d{3})`
+var iterations = 100000
+
+var r1, r2 RegExp
+
+func BenchmarkLibPcreRegexp_MatchString(b *testing.B) {
+
+	if r1 == nil {
+		r1, _ = newLibPcreRegexp(expression)
+	}
+
+	for i := iterations; i > 0; i-- {
+		r1.MatchString(inputString)
+	}
+}
+
+func BenchmarkNativeRegExp_MatchString(b *testing.B) {
+
+	if r2 == nil {
+		r2, _ = newNativeRexCompile(expression)
+	}
+
+	for i := iterations; i > 0; i-- {
+		r2.MatchString(inputString)
+	}
+}
+
+func BenchmarkLibPcreRegexp_FindStringSubmatch(b *testing.B) {
+
+	if r1 == nil {
+		r1, _ = newLibPcreRegexp(expression)
+	}
+
+	for i := iterations; i > 0; i-- {
+		r1.FindStringSubmatch(inputString)
+	}
+}
+
+func BenchmarkNativeRegExp_FindStringSubmatch(b *testing.B) {
+
+	if r2 == nil {
+		r2, _ = newNativeRexCompile(expression)
+	}
+
+	for i := iterations; i > 0; i-- {
+		r2.MatchString(inputString)
+	}
+}
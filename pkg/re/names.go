@@ -0,0 +1,84 @@
+package re
+
+import "strings"
+
+//getNamedGroupsFromExpression returns names of capturing groups in order of their numbers like regexp.SubexpNames:
+//the first element is the whole match, unnamed groups have empty names.
+//It understands (?P<name>), (?<name>), (?'name'), non-capturing groups, escapes, \Q...\E and character classes
+func getNamedGroupsFromExpression(expr string) []string {
+	names := []string{""}
+	inClass := false
+
+	for i := 0; i < len(expr); i++ {
+		c := expr[i]
+
+		switch {
+		case c == '\\' && strings.HasPrefix(expr[i:], `\Q`):
+			end := strings.Index(expr[i+2:], `\E`)
+			if end < 0 {
+				return names
+			}
+			i += end + 3
+		case c == '\\':
+			i++
+		case inClass:
+			if c == '[' && i+1 < len(expr) && expr[i+1] == ':' {
+				//posix class [:alpha:]
+				if end := strings.Index(expr[i:], ":]"); end >= 0 {
+					i += end + 1
+				}
+			} else if c == ']' {
+				inClass = false
+			}
+		case c == '[':
+			inClass = true
+			//"]" right after "[" or "[^" is a literal
+			if i+1 < len(expr) && expr[i+1] == '^' {
+				i++
+			}
+			if i+1 < len(expr) && expr[i+1] == ']' {
+				i++
+			}
+		case c == '(' && strings.HasPrefix(expr[i:], "(?#"):
+			//comment
+			if end := strings.IndexByte(expr[i:], ')'); end >= 0 {
+				i += end
+			} else {
+				return names
+			}
+		case c == '(':
+			if name, capturing := groupName(expr[i+1:]); capturing {
+				names = append(names, name)
+			}
+		}
+	}
+
+	return names
+}
+
+//groupName returns name of group which starts at the beginning of s (after "(") and whether it is capturing
+func groupName(s string) (name string, capturing bool) {
+	switch {
+	case strings.HasPrefix(s, "*"):
+		//pcre verbs like (*UTF8)
+		return "", false
+	case !strings.HasPrefix(s, "?"):
+		return "", true
+	case strings.HasPrefix(s, "?P<"):
+		return nameUntil(s[3:], '>')
+	case strings.HasPrefix(s, "?<") && !strings.HasPrefix(s, "?<=") && !strings.HasPrefix(s, "?<!"):
+		return nameUntil(s[2:], '>')
+	case strings.HasPrefix(s, "?'"):
+		return nameUntil(s[2:], '\'')
+	}
+	//(?:...), lookarounds, flags, backreferences (?P=name) etc.
+	return "", false
+}
+
+func nameUntil(s string, end byte) (string, bool) {
+	i := strings.IndexByte(s, end)
+	if i < 0 {
+		return "", true
+	}
+	return s[:i], true
+}
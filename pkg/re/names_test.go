@@ -0,0 +1,50 @@
+package re
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGetNamedGroupsFromExpression(t *testing.T) {
+	cases := []struct {
+		expr     string
+		expected []string
+	}{
+		{`foo`, []string{""}},
+		{`(?P<code>\d+)`, []string{"", "code"}},
+		{`(\S+) (?P<code>\d+)`, []string{"", "", "code"}},
+		{`(?<code>\d+) (?'time'[\d.]+)`, []string{"", "code", "time"}},
+		{`(?:GET|POST) (?P<url>\S+)`, []string{"", "url"}},
+		{`\((?P<a>x)\)`, []string{"", "a"}},
+		{`[(](?P<a>[^)]+)[)]`, []string{"", "a"}},
+		{`[]()](?P<a>x)`, []string{"", "a"}},
+		{`[^]()](?P<a>x)`, []string{"", "a"}},
+		{`[[:alpha:](](?P<a>x)`, []string{"", "a"}},
+		{`\Q(not a group)\E(?P<a>x)`, []string{"", "a"}},
+		{`(?#comment (with parens)(?P<a>x)`, []string{"", "a"}},
+		{`(?P<outer>a(?P<inner>b)(c))`, []string{"", "outer", "inner", ""}},
+		{`(?<=x)(?<!y)(?=z)(?!w)(?i)(?P<a>x)(?P=a)`, []string{"", "a"}},
+		{`(*UTF8)(?P<a>x)`, []string{"", "a"}},
+	}
+
+	for _, c := range cases {
+		actual := getNamedGroupsFromExpression(c.expr)
+		if !reflect.DeepEqual(actual, c.expected) {
+			t.Errorf("%s: expected %q, actual %q", c.expr, c.expected, actual)
+		}
+	}
+}
+
+func TestEngines(t *testing.T) {
+	if _, err := CompileEngine(`(?P<a>\d+)`, EngineNative); err != nil {
+		t.Error(err)
+	}
+
+	if _, err := CompileEngine(`\d+`, "unknown"); err == nil {
+		t.Error("unknown engine must fail")
+	}
+
+	if err := SetDefaultEngine("unknown"); err == nil {
+		t.Error("unknown engine must fail")
+	}
+}
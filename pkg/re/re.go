@@ -1,5 +1,26 @@
 package re
 
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	//EnginePcre is libpcre engine. It is not available in binary built with "nopcre" tag
+	EnginePcre = "pcre"
+	//EngineNative is RE2 engine of go standard library
+	EngineNative = "native"
+)
+
+//engines contains constructors of engines available in binary
+var engines = map[string]func(expr string) (RegExp, error){
+	EngineNative: newNativeRexCompile,
+}
+
+//defaultEngine is used by Compile. It is pcre if binary is built with libpcre
+var defaultEngine = EngineNative
+
 //RegExp matches regular expression and returns matched strings
 type RegExp interface {
 	MatchString(s string) bool
@@ -8,17 +29,54 @@ type RegExp interface {
 	String() string
 }
 
-//Compile returns implementation of RegExp
+//Engines returns names of engines available in binary
+func Engines() []string {
+	names := make([]string, 0, len(engines))
+	for name := range engines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+//SetDefaultEngine sets engine which is used by Compile and MustCompile
+func SetDefaultEngine(engine string) error {
+	if _, ok := engines[engine]; !ok {
+		return unknownEngineError(engine)
+	}
+	defaultEngine = engine
+	return nil
+}
+
+//Compile returns implementation of RegExp by default engine
 func Compile(expr string) (RegExp, error) {
-	return newLibPcreRegexp(expr)
+	return CompileEngine(expr, "")
+}
+
+//CompileEngine returns implementation of RegExp by engine. Default engine is used if engine is empty
+func CompileEngine(expr string, engine string) (RegExp, error) {
+	if engine == "" {
+		engine = defaultEngine
+	}
+
+	compile, ok := engines[engine]
+	if !ok {
+		return nil, unknownEngineError(engine)
+	}
+	return compile(expr)
 }
 
 //MustCompile returns implementation of RegExp or panic
 func MustCompile(expr string) RegExp {
-	r, err := newLibPcreRegexp(expr)
+	r, err := Compile(expr)
 
 	if err != nil {
 		panic(err)
 	}
 	return r
 }
+
+func unknownEngineError(engine string) error {
+	return fmt.Errorf("regexp engine \"%s\" is not available. Available engines: %s",
+		engine, strings.Join(Engines(), ", "))
+}
@@ -49,8 +49,9 @@ func TestNewRegexp(t *testing.T) {
 	}
 
 	for _, tCase := range testCases {
-		check(newLibPcreRegexp, tCase.expr, tCase.mustCompile)
-		check(newNativeRexCompile, tCase.expr, tCase.mustCompile)
+		for _, compile := range engines {
+			check(compile, tCase.expr, tCase.mustCompile)
+		}
 	}
 }
 
@@ -86,8 +87,9 @@ func TestMatchString(t *testing.T) {
 	}
 
 	for _, tCase := range testCases {
-		check(newLibPcreRegexp, tCase.expr, tCase.s, tCase.expectedMatchString)
-		check(newNativeRexCompile, tCase.expr, tCase.s, tCase.expectedMatchString)
+		for _, compile := range engines {
+			check(compile, tCase.expr, tCase.s, tCase.expectedMatchString)
+		}
 	}
 
 }
@@ -133,8 +135,9 @@ func TestFindStringSubmatch(t *testing.T) {
 	}
 
 	for _, tCase := range testCases {
-		check(newLibPcreRegexp, tCase.expr, tCase.s, tCase.expectedSubmatches)
-		check(newNativeRexCompile, tCase.expr, tCase.s, tCase.expectedSubmatches)
+		for _, compile := range engines {
+			check(compile, tCase.expr, tCase.s, tCase.expectedSubmatches)
+		}
 	}
 }
 
@@ -190,63 +193,12 @@ func TestSubexpNames(t *testing.T) {
 	}
 
 	for _, tCase := range testCases {
-		check(newLibPcreRegexp, tCase.expr, tCase.s, tCase.expectedGroups)
-		check(newNativeRexCompile, tCase.expr, tCase.s, tCase.expectedGroups)
+		for _, compile := range engines {
+			check(compile, tCase.expr, tCase.s, tCase.expectedGroups)
+		}
 	}
 }
 
 func getFunctionName(i interface{}) string {
 	return runtime.FuncForPC(reflect.ValueOf(i).Pointer()).Name()
 }
-
-var inputString = `s.auto.drom.ru s.auto.drom.ru 217.118.78.99 - [2017-03-19T20:57:44+10:00] GET "/i24204/r/photos/249454/gen177_1119983.jpg" HTTP/1.1 200 9453 "http://www.drom.ru/" "Mozilla/5.0 (Linux; Android 4.4.4; SM-T116 Build/KTU84P) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/48.0.2564.95 Safari/537.36" 0.200 717 "-" "-" HIT "-/" bad75053zRkT2GgTtk25FGYmFoYnw0a7 -`
-
-//very slow in libpcre and fast in regexp
-var expression = `HTTP/\d.?\d?\s(?P<code>\d+)[^"]+"[^"]*" "[^"]*" (?P<time>\d{1,}\.\d{3})`
-var iterations = 100000
-
-var r1, r2 RegExp
-
-func BenchmarkLibPcreRegexp_MatchString(b *testing.B) {
-
-	if r1 == nil {
-		r1, _ = newLibPcreRegexp(expression)
-	}
-
-	for i := iterations; i > 0; i-- {
-		r1.MatchString(inputString)
-	}
-}
-
-func BenchmarkNativeRegExp_MatchString(b *testing.B) {
-
-	if r2 == nil {
-		r2, _ = newNativeRexCompile(expression)
-	}
-
-	for i := iterations; i > 0; i-- {
-		r2.MatchString(inputString)
-	}
-}
-
-func BenchmarkLibPcreRegexp_FindStringSubmatch(b *testing.B) {
-
-	if r1 == nil {
-		r1, _ = newLibPcreRegexp(expression)
-	}
-
-	for i := iterations; i > 0; i-- {
-		r1.FindStringSubmatch(inputString)
-	}
-}
-
-func BenchmarkNativeRegExp_FindStringSubmatch(b *testing.B) {
-
-	if r2 == nil {
-		r2, _ = newNativeRexCompile(expression)
-	}
-
-	for i := iterations; i > 0; i-- {
-		r2.MatchString(inputString)
-	}
-}
@@ -0,0 +1,171 @@
+package pkg
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/blackbass1988/access_logs_stats/pkg/metrics"
+	"github.com/blackbass1988/access_logs_stats/pkg/output"
+)
+
+const (
+	//DefaultSelfMetricsPrefix is a prefix of self metrics if "prefix" of "self_metrics" is not set
+	DefaultSelfMetricsPrefix = "als_"
+
+	//DefaultUnmatchedSampleLimit is a max count of unmatched lines written per period if "limit" is not set
+	DefaultUnmatchedSampleLimit = 10
+)
+
+//SelfMetricsConfig is a "self_metrics" section of config
+type SelfMetricsConfig struct {
+	//Outputs enables sending of self metrics to all outputs
+	Outputs bool   `json:"outputs" yaml:"outputs"`
+	Prefix  string `json:"prefix" yaml:"prefix"`
+}
+
+func (c SelfMetricsConfig) getPrefix() string {
+	if c.Prefix != "" {
+		return c.Prefix
+	}
+	return DefaultSelfMetricsPrefix
+}
+
+//UnmatchedSampleConfig is an "unmatched_sample" section of config
+type UnmatchedSampleConfig struct {
+	//File where unmatched lines are written. Lines are written to log if empty
+	File  string `json:"file" yaml:"file"`
+	Limit int    `json:"limit" yaml:"limit"`
+}
+
+//lineStats counts lines of period which were parsed or thrown away by parser
+type lineStats struct {
+	matched   uint64
+	unmatched uint64
+}
+
+//send adds line stats to output as prefix+"lines" field
+func (l lineStats) send(o *output.Output) {
+	total := l.matched + l.unmatched
+
+	//without lines nothing was lost
+	ratio := 1.0
+	if total > 0 {
+		ratio = float64(l.matched) / float64(total)
+	}
+
+	o.AddMessage("lines", "total", fmt.Sprintf("%d", total))
+	o.AddMessage("lines", "matched", fmt.Sprintf("%d", l.matched))
+	o.AddMessage("lines", "unmatched", fmt.Sprintf("%d", l.unmatched))
+	o.AddMessage("lines", "matched_ratio", fmt.Sprintf("%.3f", ratio))
+}
+
+//pipelineMetrics are internal metrics of pipeline. They are labeled with input of config
+type pipelineMetrics struct {
+	linesRead *metrics.Counter
+	parse     *metrics.Summary
+	backlog   *metrics.Gauge
+	sendStats *metrics.Summary
+}
+
+func newPipelineMetrics(input string) *pipelineMetrics {
+	labels := map[string]string{"input": input}
+	return &pipelineMetrics{
+		linesRead: metrics.Default.Counter("lines_read", labels),
+		parse:     metrics.Default.Summary("parse_seconds", labels),
+		backlog:   metrics.Default.Gauge("line_channel_backlog", labels),
+		sendStats: metrics.Default.Summary("send_stats_seconds", labels),
+	}
+}
+
+func (m *pipelineMetrics) unregister() {
+	metrics.Default.Unregister(m.linesRead, m.parse, m.backlog, m.sendStats)
+}
+
+//sendInternalMetrics adds metrics of registry to output. Metrics of other inputs are skipped,
+//metrics without input (of outputs) are added by every pipeline
+func sendInternalMetrics(o *output.Output, input string) {
+	for _, s := range metrics.Default.Samples() {
+		if i, ok := s.Labels["input"]; ok && i != input {
+			continue
+		}
+
+		var labels map[string]string
+		for k, v := range s.Labels {
+			if k == "input" {
+				continue
+			}
+			if labels == nil {
+				labels = make(map[string]string)
+			}
+			labels[k] = v
+		}
+
+		o.SetLabels(labels)
+		o.AddMessage(s.Name, s.Metric, strconv.FormatFloat(s.Value, 'f', -1, 64))
+	}
+	o.SetLabels(nil)
+}
+
+//unmatchedSampler writes no more than limit unmatched lines per period to file or log
+type unmatchedSampler struct {
+	limit   int
+	file    *os.File
+	written int
+	skipped int
+}
+
+func newUnmatchedSampler(c *UnmatchedSampleConfig) (*unmatchedSampler, error) {
+	s := new(unmatchedSampler)
+	s.limit = c.Limit
+	if s.limit <= 0 {
+		s.limit = DefaultUnmatchedSampleLimit
+	}
+
+	if c.File != "" {
+		f, err := os.OpenFile(c.File, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		if err != nil {
+			return nil, err
+		}
+		s.file = f
+	}
+	return s, nil
+}
+
+func (s *unmatchedSampler) sample(line string) {
+	if s.written >= s.limit {
+		s.skipped++
+		return
+	}
+	s.written++
+	//line of input ends with newline already
+	line = strings.TrimRight(line, "\r\n")
+
+	if s.file == nil {
+		log.Printf("unmatched line: %s\n", line)
+		return
+	}
+
+	if _, err := fmt.Fprintf(s.file, "%s %s\n", time.Now().Format(time.RFC3339), line); err != nil {
+		log.Println("unmatched sample write error:", err)
+	}
+}
+
+//reset starts new period
+func (s *unmatchedSampler) reset() {
+	if s.skipped > 0 {
+		log.Printf("%d more unmatched lines were not sampled in period\n", s.skipped)
+	}
+	s.written = 0
+	s.skipped = 0
+}
+
+func (s *unmatchedSampler) close() error {
+	if s.file == nil {
+		return nil
+	}
+	return s.file.Close()
+}
@@ -0,0 +1,93 @@
+package pkg
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blackbass1988/access_logs_stats/pkg/input"
+	"github.com/blackbass1988/access_logs_stats/pkg/output"
+)
+
+var selfMetricsTarget = new(fakeTarget)
+
+func init() {
+	output.RegisterOutput("self_metrics_test", func(params map[string]string, templateVars map[string]string) (output.Target, error) {
+		return selfMetricsTarget, nil
+	})
+}
+
+func TestLineStats(t *testing.T) {
+	sampleFile, err := ioutil.TempFile("", "als_unmatched_*.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sampleFile.Close()
+	defer os.Remove(sampleFile.Name())
+
+	config := &Config{
+		Period:          time.Second,
+		Outputs:         []*outputConfig{{Name: "test", Type: "self_metrics_test"}},
+		SelfMetrics:     SelfMetricsConfig{Outputs: true},
+		UnmatchedSample: &UnmatchedSampleConfig{File: sampleFile.Name(), Limit: 2},
+	}
+
+	s, err := NewSenderCollection(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.appendData(&RowEntry{Fields: map[string]string{}}, input.Position{})
+	s.appendData(&RowEntry{Fields: map[string]string{}}, input.Position{})
+	for _, line := range []string{"bad 1\n", "bad 2\n", "bad 3\n"} {
+		s.appendUnmatched(input.Line{Text: line})
+	}
+	s.sendStats(time.Now(), time.Second)
+
+	expected := map[string]string{"total": "5", "matched": "2", "unmatched": "3", "matched_ratio": "0.400"}
+	checkLineStats(t, expected)
+
+	selfMetricsTarget.messages = nil
+	s.sendStats(time.Now(), time.Second)
+	checkLineStats(t, map[string]string{"total": "0", "matched": "0", "unmatched": "0", "matched_ratio": "1.000"})
+	s.close()
+
+	content, err := ioutil.ReadFile(sampleFile.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	if len(lines) != 2 || !strings.HasSuffix(lines[0], " bad 1") || !strings.HasSuffix(lines[1], " bad 2") {
+		t.Errorf("sample must contain 2 first unmatched lines, actual %q", lines)
+	}
+}
+
+func checkLineStats(t *testing.T, expected map[string]string) {
+	lines := make(map[string]string)
+	internal := make(map[string]bool)
+	for _, m := range selfMetricsTarget.messages {
+		if m.Field == DefaultSelfMetricsPrefix+"lines" {
+			lines[m.Metric] = m.Value
+		} else {
+			internal[m.RawField] = true
+		}
+	}
+
+	if len(lines) != len(expected) {
+		t.Errorf("expected line stats %v, actual %v", expected, lines)
+	}
+	for metric, value := range expected {
+		if lines[metric] != value {
+			t.Errorf("lines.%s expected %s, actual %s", metric, value, lines[metric])
+		}
+	}
+
+	for _, name := range []string{"lines_read", "parse_seconds", "line_channel_backlog", "send_stats_seconds"} {
+		if !internal[name] {
+			t.Errorf("internal metric %s was not sent, sent %v", name, internal)
+		}
+	}
+}
@@ -6,7 +6,9 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
+	"github.com/blackbass1988/access_logs_stats/pkg/metrics"
 	"github.com/blackbass1988/access_logs_stats/pkg/output"
 )
 
@@ -20,11 +22,32 @@ type Sender struct {
 	//настроенный отправлятор, реализации настраиваются в конфиге "outputs"
 	output *output.Output
 
+	//кол-во секунд в текущем периоде. Обычно равно "period" конфигурации,
+	//но при остановке приложения последний период может быть короче
+	periodInSeconds float64
+
+	//данные по группам "group_by" фильтра. Ключ - значения полей группы.
+	//если group_by не указан, то группа одна с пустым ключом
+	groups map[string]*senderGroup
+
+	//appendTime is an internal metric of appendIfOk duration
+	appendTime *metrics.Summary
+	//invalidNumbers counts values of aggregate fields which are not numbers, e.g. "-" or ""
+	invalidNumbers *metrics.Counter
+
+	globalLock sync.Mutex
+}
+
+//senderGroup contains data of one group of filter's group_by
+type senderGroup struct {
+	//значения полей group_by. Передаются в output как labels
+	labels map[string]string
+
 	//мап флоатов с реализацией агрегирующих фунций
 	floatData map[string]*Float64Data
 
-	//закешированное кол-во секунд в периоде, указанному в "period" конфигурации
-	periodInSeconds float64
+	//скетчи полей из "aggregates", для которых указан ddsketch. Значения в них не хранятся
+	sketches map[string]*DDSketch
 
 	//здесь хранятся числа по полям, указанные в "aggregates" конфигурации
 	floatsForAggregates map[string][]float64
@@ -33,37 +56,86 @@ type Sender struct {
 	//хранится по схеме поле.уник_значение.кол-во
 	//вывод происходит по схеме - кол-во в 1 секунду
 	counts map[string]map[string]uint64
+}
 
-	globalLock sync.Mutex
+func (s *Sender) newGroup(labels map[string]string) *senderGroup {
+	g := new(senderGroup)
+	g.labels = labels
+	g.floatsForAggregates = make(map[string][]float64)
+	g.floatData = make(map[string]*Float64Data)
+	g.counts = make(map[string]map[string]uint64)
+	g.sketches = make(map[string]*DDSketch)
+	for field, relativeError := range s.config.Sketches {
+		g.sketches[field] = NewDDSketch(relativeError)
+	}
+	return g
 }
 
 func (s *Sender) resetData() {
 	s.globalLock.Lock()
-	s.floatsForAggregates = make(map[string][]float64)
-	s.floatData = make(map[string]*Float64Data)
-	s.counts = make(map[string]map[string]uint64)
+	s.groups = make(map[string]*senderGroup)
+	if len(s.filter.GroupBy) == 0 {
+		//without group_by metrics are sent even if there were no rows
+		s.groups[""] = s.newGroup(nil)
+	}
 	s.globalLock.Unlock()
 }
 
+//getGroup returns group of row. Rows of new groups over filter's group_limit get to overflow group
+func (s *Sender) getGroup(row *RowEntry) *senderGroup {
+	if len(s.filter.GroupBy) == 0 {
+		return s.groups[""]
+	}
+
+	values := make([]string, len(s.filter.GroupBy))
+	for i, field := range s.filter.GroupBy {
+		values[i] = row.Fields[field]
+	}
+	key := strings.Join(values, "\x00")
+
+	if g, ok := s.groups[key]; ok {
+		return g
+	}
+
+	if len(s.groups) >= s.filter.getGroupLimit() {
+		for i := range values {
+			values[i] = GroupOverflowValue
+		}
+		key = strings.Join(values, "\x00")
+
+		if g, ok := s.groups[key]; ok {
+			return g
+		}
+	}
+
+	labels := make(map[string]string)
+	for i, field := range s.filter.GroupBy {
+		labels[field] = values[i]
+	}
+	g := s.newGroup(labels)
+	s.groups[key] = g
+	return g
+}
+
 func (s *Sender) appendIfOk(row *RowEntry) (err error) {
+	defer s.appendTime.ObserveSince(time.Now())
 
-	if s.filter.MatchString(row.Raw) {
+	if s.filter.Match(row) {
+		g := s.getGroup(row)
 
 		for field, val := range row.Fields {
 
 			if _, ok := s.config.Aggregates[field]; ok {
-				valFloat, err := strconv.ParseFloat(val, 10)
-				checkOrFail(err)
-				s.floatsForAggregates[field] = append(s.floatsForAggregates[field], valFloat)
+				s.appendAggregate(g, field, val, row)
 			}
 
 			//в конфиге указано поле, как поле, по которому считаются
 			// суммы по уникальным значениям
 			if _, ok := s.config.Counts[field]; ok {
-				if s.counts[field] == nil {
-					s.counts[field] = make(map[string]uint64)
+				if g.counts[field] == nil {
+					g.counts[field] = make(map[string]uint64)
 				}
-				s.counts[field][val]++
+				g.counts[field][val]++
 			}
 		}
 	}
@@ -71,13 +143,46 @@ func (s *Sender) appendIfOk(row *RowEntry) (err error) {
 	return err
 }
 
-func (s *Sender) sendStats() (err error) {
+//appendAggregate adds value of aggregate field to group. Value which is not a number is skipped and counted
+func (s *Sender) appendAggregate(g *senderGroup, field string, val string, row *RowEntry) {
+	valFloat, ok := row.Numbers[field]
+	if !ok {
+		var err error
+		if valFloat, err = strconv.ParseFloat(val, 10); err != nil {
+			s.invalidNumbers.Inc()
+			return
+		}
+	}
+
+	if sketch, ok := g.sketches[field]; ok {
+		sketch.Add(valFloat)
+	} else {
+		g.floatsForAggregates[field] = append(g.floatsForAggregates[field], valFloat)
+	}
+}
+
+//sendStats sends stats gathered for elapsed duration which ended at now
+func (s *Sender) sendStats(now time.Time, elapsed time.Duration) (err error) {
 
 	s.globalLock.Lock()
-	for _, metricsOfField := range s.filter.Items {
+	s.output.SetTime(now)
+	s.periodInSeconds = elapsed.Seconds()
+
+	keys := make([]string, 0, len(s.groups))
+	for key := range s.groups {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
 
-		for _, metric := range metricsOfField.Metrics {
-			s.appendToOutput(metricsOfField.Field, metric)
+	for _, key := range keys {
+		g := s.groups[key]
+		s.output.SetLabels(g.labels)
+
+		for _, metricsOfField := range s.filter.Items {
+
+			for _, metric := range metricsOfField.Metrics {
+				s.appendToOutput(g, metricsOfField.Field, metric)
+			}
 		}
 	}
 	s.output.Send()
@@ -87,25 +192,37 @@ func (s *Sender) sendStats() (err error) {
 }
 
 //NewSender create new sender
-func NewSender(filter *Filter, config *Config) (*Sender, error) {
+func NewSender(filter *Filter, config *Config, targets []output.Target) (*Sender, error) {
 	sender := new(Sender)
 	sender.filter = filter
 	sender.config = config
 
 	sender.output = new(output.Output)
+	labels := map[string]string{
+		"input":  config.InputDsn,
+		"filter": filter.String(),
+		"prefix": filter.Prefix,
+	}
+	sender.appendTime = metrics.Default.Summary("sender_append_seconds", labels)
+	sender.invalidNumbers = metrics.Default.Counter("invalid_numbers", labels)
 
 	if len(filter.Prefix) > 0 {
 		sender.output.SetPrefix(filter.Prefix)
 	}
 
-	for _, s := range config.Outputs {
-		sender.output.Init(s.Type, s.Settings, config.TemplateVars)
+	for _, t := range targets {
+		sender.output.AddTarget(t)
 	}
 
 	return sender, nil
 }
 
-func (s *Sender) appendToOutput(field string, metric string) {
+//unregisterMetrics removes internal metrics of sender from registry
+func (s *Sender) unregisterMetrics() {
+	metrics.Default.Unregister(s.appendTime, s.invalidNumbers)
+}
+
+func (s *Sender) appendToOutput(g *senderGroup, field string, metric string) {
 	var (
 		periodInSeconds float64
 		value           string
@@ -113,45 +230,45 @@ func (s *Sender) appendToOutput(field string, metric string) {
 
 	switch {
 	case metric == "min":
-		value = fmt.Sprintf("%.3f", s.getFloatData(field).Min())
+		value = fmt.Sprintf("%.3f", g.getFloatData(field).Min())
 	case metric == "max":
-		value = fmt.Sprintf("%.3f", s.getFloatData(field).Max())
+		value = fmt.Sprintf("%.3f", g.getFloatData(field).Max())
 	case metric == "len":
-		value = fmt.Sprintf("%d", s.getFloatData(field).Len())
+		value = fmt.Sprintf("%d", g.getFloatData(field).Len())
 	case metric == "avg":
-		value = fmt.Sprintf("%.3f", s.getFloatData(field).Avg())
+		value = fmt.Sprintf("%.3f", g.getFloatData(field).Avg())
 	case metric == "sum":
-		value = fmt.Sprintf("%.3f", s.getFloatData(field).Sum())
+		value = fmt.Sprintf("%.3f", g.getFloatData(field).Sum())
 	case metric == "sum_ps":
-		result := s.getFloatData(field).Sum()
+		result := g.getFloatData(field).Sum()
 		periodInSeconds = s.getPeriodInSeconds()
 		if periodInSeconds == 0 {
 			result = 0
 		} else {
-			result = s.getFloatData(field).Sum() / s.getPeriodInSeconds()
+			result = g.getFloatData(field).Sum() / s.getPeriodInSeconds()
 		}
 
 		value = fmt.Sprintf("%.3f", result)
 	case metric == "ips":
-		value = fmt.Sprintf("%.3f", s.getFloatData(field).ItemsPerSeconds(s.getPeriodInSeconds()))
+		value = fmt.Sprintf("%.3f", g.getFloatData(field).ItemsPerSeconds(s.getPeriodInSeconds()))
 	case strings.Contains(metric, "cent_"):
 		cent := strings.Split(metric, "_")
 		centFloat, err := strconv.ParseFloat(cent[1], 10)
 		checkOrFail(err)
-		value = fmt.Sprintf("%.3f", s.getFloatData(field).Percentile(centFloat))
+		value = fmt.Sprintf("%.3f", g.getFloatData(field).Percentile(centFloat))
 	case metric == "uniq":
-		value = fmt.Sprintf("%d", s.getUniqCnt(field))
+		value = fmt.Sprintf("%d", g.getUniqCnt(field))
 	case metric == "uniq_ps":
-		value = fmt.Sprintf("%.3f", float64(s.getUniqCnt(field))/s.getPeriodInSeconds())
+		value = fmt.Sprintf("%.3f", float64(g.getUniqCnt(field))/s.getPeriodInSeconds())
 	case strings.Contains(metric, "cps_"):
-		value = s.processCps(metric, field)
+		value = s.processCps(g, metric, field)
 	case strings.Contains(metric, "percentage_"):
-		value = s.processPercentage(metric, field)
+		value = s.processPercentage(g, metric, field)
 	}
 	s.output.AddMessage(field, metric, value)
 }
 
-func (s *Sender) processCps(metric string, field string) string {
+func (s *Sender) processCps(g *senderGroup, metric string, field string) string {
 	var (
 		ok  bool
 		cnt uint64
@@ -159,15 +276,15 @@ func (s *Sender) processCps(metric string, field string) string {
 
 	metrics := strings.SplitN(metric, "_", 2)
 	metric = metrics[1]
-	if _, ok = s.counts[field]; !ok {
+	if _, ok = g.counts[field]; !ok {
 		cnt = 0
-	} else if cnt, ok = s.counts[field][metric]; !ok {
+	} else if cnt, ok = g.counts[field][metric]; !ok {
 		cnt = 0
 	}
 	return fmt.Sprintf("%.3f", float64(cnt)/s.getPeriodInSeconds())
 }
 
-func (s *Sender) processPercentage(metric string, field string) string {
+func (s *Sender) processPercentage(g *senderGroup, metric string, field string) string {
 	var (
 		ok     bool
 		cnt    uint64
@@ -177,51 +294,67 @@ func (s *Sender) processPercentage(metric string, field string) string {
 	metrics := strings.Split(metric, "_")
 	metric = metrics[1]
 
-	total := s.getTotalCountByField(field)
+	total := g.getTotalCountByField(field)
 
 	result = 0
-	if cnt, ok = s.counts[field][metric]; ok && total > 0 {
+	if cnt, ok = g.counts[field][metric]; ok && total > 0 {
 		result = float64(cnt * 100 / total)
 	}
 	return fmt.Sprintf("%.3f", result)
 }
 
-func (s *Sender) getTotalCountByField(field string) uint64 {
+func (g *senderGroup) getTotalCountByField(field string) uint64 {
 	var (
 		ok  bool
 		cnt uint64
 	)
-	if _, ok = s.counts[field]; !ok {
+	if _, ok = g.counts[field]; !ok {
 		return 0
 	}
 
 	cnt = 0
-	for _, c := range s.counts[field] {
+	for _, c := range g.counts[field] {
 		cnt += c
 	}
 
 	return cnt
 }
 
-func (s *Sender) getUniqCnt(field string) uint64 {
+func (g *senderGroup) getUniqCnt(field string) uint64 {
 	var (
 		cnt uint64
 		ok  bool
 	)
 	cnt = 0
-	if _, ok = s.counts[field]; ok {
-		cnt = uint64(len(s.counts[field]))
+	if _, ok = g.counts[field]; ok {
+		cnt = uint64(len(g.counts[field]))
 	}
 	return cnt
 }
-func (s *Sender) getFloatData(field string) *Float64Data {
+
+//aggregateData is implemented by Float64Data and DDSketch
+type aggregateData interface {
+	Min() float64
+	Max() float64
+	Len() int
+	Avg() float64
+	Sum() float64
+	Percentile(cent float64) float64
+	ItemsPerSeconds(seconds float64) float64
+}
+
+func (g *senderGroup) getFloatData(field string) aggregateData {
+	if sketch, ok := g.sketches[field]; ok {
+		return sketch
+	}
+
 	//кешируем флоатдату
-	if _, ok := s.floatData[field]; !ok {
-		f := Float64Data(s.floatsForAggregates[field])
-		s.floatData[field] = &f
-		sort.Sort(s.floatData[field])
+	if _, ok := g.floatData[field]; !ok {
+		f := Float64Data(g.floatsForAggregates[field])
+		g.floatData[field] = &f
+		sort.Sort(g.floatData[field])
 	}
-	return s.floatData[field]
+	return g.floatData[field]
 }
 
 func (s *Sender) getPeriodInSeconds() float64 {
@@ -1,43 +1,141 @@
 package pkg
 
 import (
+	"log"
+	"strconv"
 	"sync"
+	"time"
+
+	"github.com/blackbass1988/access_logs_stats/pkg/input"
+	"github.com/blackbass1988/access_logs_stats/pkg/output"
 )
 
 //SenderCollection is a collection of Senders
 type SenderCollection struct {
-	procs  []*Sender
-	config *Config
+	procs   []*Sender
+	config  *Config
+	targets []output.Target
+
+	//lines of current period and sample of unmatched ones. sampler is nil if "unmatched_sample" is not set
+	lines   lineStats
+	sampler *unmatchedSampler
+
+	//positions of the last appended line of every file of current period. They are saved by checkpoint after sending
+	positions map[string]input.Position
+
+	metrics *pipelineMetrics
+
+	//sends contains time of last successful sending of every output for /readyz
+	sends *outputSends
+
+	//selfOutput sends self metrics to all targets. It is nil if self metrics are not sent to outputs
+	selfOutput *output.Output
 
 	m sync.Mutex
 }
 
 //NewSenderCollection create SenderCollection of Senders
-func NewSenderCollection(config *Config) *SenderCollection {
+func NewSenderCollection(config *Config) (*SenderCollection, error) {
 	subProcesses := new(SenderCollection)
 
+	//every entry of "output" section is an own instance shared by all filters.
+	//Instances with the same settings are shared between pipelines too
+	targets := []output.Target{}
+	for _, o := range config.Outputs {
+		t, err := output.AcquireTarget(o.Type, o.Settings, config.TemplateVars)
+		if err != nil {
+			for _, acquired := range targets {
+				output.ReleaseTarget(acquired)
+			}
+			return nil, err
+		}
+		targets = append(targets, t)
+	}
+
+	//senders use wrapped targets which record successful sendings
+	sends := newOutputSends(config.Outputs)
+	sendsTargets := []output.Target{}
+	for i, o := range config.Outputs {
+		sendsTargets = append(sendsTargets, &sendsTarget{targets[i], o.Name, sends})
+	}
+
 	processes := []*Sender{}
-	for _, f := range config.Filters {
-		sp, err := NewSender(f, config)
-		checkOrFail(err)
+	for n, f := range config.Filters {
+		filterTargets := []output.Target{}
+		for i, o := range config.Outputs {
+			if f.SendsTo(o.Name) {
+				filterTargets = append(filterTargets, sendsTargets[i])
+			}
+		}
+
+		sp, err := NewSender(f, config, filterTargets)
+		if err != nil {
+			return nil, err
+		}
+		sp.output.SetSource(config.filepath, "filter "+strconv.Itoa(n))
 		processes = append(processes, sp)
 	}
 
+	if config.SelfMetrics.Outputs {
+		subProcesses.selfOutput = new(output.Output)
+		subProcesses.selfOutput.SetPrefix(config.SelfMetrics.getPrefix())
+		subProcesses.selfOutput.SetSource(config.filepath, "self_metrics")
+		for _, t := range sendsTargets {
+			subProcesses.selfOutput.AddTarget(t)
+		}
+	}
+
+	if config.UnmatchedSample != nil {
+		sampler, err := newUnmatchedSampler(config.UnmatchedSample)
+		if err != nil {
+			for _, acquired := range targets {
+				output.ReleaseTarget(acquired)
+			}
+			for _, proc := range processes {
+				proc.unregisterMetrics()
+			}
+			return nil, err
+		}
+		subProcesses.sampler = sampler
+	}
+
+	subProcesses.metrics = newPipelineMetrics(config.InputDsn)
+	subProcesses.sends = sends
 	subProcesses.procs = processes
+	subProcesses.targets = targets
 	subProcesses.config = config
 	subProcesses.resetData()
-	return subProcesses
+	return subProcesses, nil
 }
 
 func (s *SenderCollection) resetData() {
 	for _, proc := range s.procs {
 		proc.resetData()
 	}
+
+	s.lines = lineStats{}
+	s.positions = make(map[string]input.Position)
+	if s.sampler != nil {
+		s.sampler.reset()
+	}
 }
 
-//appendData appends RowEntry to every filter instance from config
-func (s *SenderCollection) appendData(row *RowEntry) {
+//appendUnmatched counts line which was thrown away by parser
+func (s *SenderCollection) appendUnmatched(line input.Line) {
 	s.m.Lock()
+	s.lines.unmatched++
+	s.appendPosition(line.Position)
+	if s.sampler != nil {
+		s.sampler.sample(line.Text)
+	}
+	s.m.Unlock()
+}
+
+//appendData appends RowEntry of line at pos to every filter instance from config
+func (s *SenderCollection) appendData(row *RowEntry, pos input.Position) {
+	s.m.Lock()
+	s.lines.matched++
+	s.appendPosition(pos)
 	var wg sync.WaitGroup
 	wg.Add(len(s.procs))
 	for _, proc := range s.procs {
@@ -50,19 +148,66 @@ func (s *SenderCollection) appendData(row *RowEntry) {
 	s.m.Unlock()
 }
 
-func (s *SenderCollection) sendStats() {
+//appendPosition records position of appended line. s.m must be locked
+func (s *SenderCollection) appendPosition(pos input.Position) {
+	if pos.File != "" {
+		s.positions[pos.File] = pos
+	}
+}
+
+//sendStats sends stats of all filters gathered for elapsed duration and resets them.
+//It returns positions of lines which were appended to sent stats
+func (s *SenderCollection) sendStats(now time.Time, elapsed time.Duration) []input.Position {
 	s.m.Lock()
+	defer s.m.Unlock()
+
+	positions := make([]input.Position, 0, len(s.positions))
+	for _, pos := range s.positions {
+		positions = append(positions, pos)
+	}
+
+	start := time.Now()
 	var wg sync.WaitGroup
 	wg.Add(len(s.procs))
 
 	for _, proc := range s.procs {
 		go func(proc *Sender) {
 			defer wg.Done()
-			proc.sendStats()
+			proc.sendStats(now, elapsed)
 		}(proc)
 	}
 	wg.Wait()
 
+	if s.selfOutput != nil {
+		s.selfOutput.SetTime(now)
+		s.lines.send(s.selfOutput)
+		sendInternalMetrics(s.selfOutput, s.config.InputDsn)
+		s.selfOutput.Send()
+	}
+
 	s.resetData()
+	s.metrics.sendStats.ObserveSince(start)
+	return positions
+}
+
+//close closes all outputs and removes internal metrics of pipeline. It waits for sending in progress
+func (s *SenderCollection) close() {
+	s.m.Lock()
+	s.metrics.unregister()
+	for _, proc := range s.procs {
+		proc.unregisterMetrics()
+	}
+
+	for _, t := range s.targets {
+		if err := output.ReleaseTarget(t); err != nil {
+			log.Println("output close error:", err)
+		}
+	}
+
+	if s.sampler != nil {
+		if err := s.sampler.close(); err != nil {
+			log.Println("unmatched sample close error:", err)
+		}
+	}
 	s.m.Unlock()
 }
@@ -0,0 +1,384 @@
+package pkg
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/blackbass1988/access_logs_stats/pkg/input"
+	"github.com/blackbass1988/access_logs_stats/pkg/output"
+)
+
+//fakeTarget collects sent messages. Senders of collection send to it in parallel
+type fakeTarget struct {
+	messages []*output.Message
+	m        sync.Mutex
+}
+
+func (f *fakeTarget) Send(messages []*output.Message) error {
+	f.m.Lock()
+	f.messages = append(f.messages, messages...)
+	f.m.Unlock()
+	return nil
+}
+
+func newTestSender(t *testing.T, filter *Filter) (*Sender, *fakeTarget) {
+	m, err := newmatcher(".+", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	filter.Matcher = &m
+	filter.Items = append(filter.Items, FilterItem{"time", []string{"len", "max"}})
+
+	config := &Config{
+		Period:     time.Second,
+		Aggregates: map[string]bool{"time": true},
+		Counts:     map[string]bool{},
+	}
+
+	target := new(fakeTarget)
+	s, err := NewSender(filter, config, []output.Target{target})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.resetData()
+	return s, target
+}
+
+func appendRows(s *Sender, rows ...map[string]string) {
+	for _, fields := range rows {
+		s.appendIfOk(&RowEntry{Fields: fields})
+	}
+}
+
+func TestSenderGroupBy(t *testing.T) {
+	s, target := newTestSender(t, &Filter{GroupBy: []string{"vhost"}})
+
+	appendRows(s,
+		map[string]string{"vhost": "api", "time": "0.1"},
+		map[string]string{"vhost": "api", "time": "0.3"},
+		map[string]string{"vhost": "m", "time": "0.2"},
+	)
+	s.sendStats(time.Now(), time.Second)
+
+	expected := []struct {
+		vhost, metric, value string
+	}{
+		{"api", "len", "2"},
+		{"api", "max", "0.300"},
+		{"m", "len", "1"},
+		{"m", "max", "0.200"},
+	}
+
+	if len(target.messages) != len(expected) {
+		t.Fatalf("expected %d messages, actual %d", len(expected), len(target.messages))
+	}
+
+	for i, e := range expected {
+		m := target.messages[i]
+		if m.Labels["vhost"] != e.vhost || m.Metric != e.metric || m.Value != e.value {
+			t.Errorf("message %d expected %+v, actual %+v %+v", i, e, m, m.Labels)
+		}
+	}
+}
+
+func TestSenderGroupLimit(t *testing.T) {
+	s, target := newTestSender(t, &Filter{GroupBy: []string{"vhost"}, GroupLimit: 2})
+
+	appendRows(s,
+		map[string]string{"vhost": "a", "time": "1"},
+		map[string]string{"vhost": "b", "time": "1"},
+		map[string]string{"vhost": "c", "time": "1"},
+		map[string]string{"vhost": "d", "time": "1"},
+		map[string]string{"vhost": "a", "time": "1"},
+	)
+	s.sendStats(time.Now(), time.Second)
+
+	lens := make(map[string]string)
+	for _, m := range target.messages {
+		if m.Metric == "len" {
+			lens[m.Labels["vhost"]] = m.Value
+		}
+	}
+
+	expected := map[string]string{"a": "2", "b": "1", GroupOverflowValue: "2"}
+	if len(lens) != len(expected) {
+		t.Errorf("expected groups %v, actual %v", expected, lens)
+	}
+	for vhost, value := range expected {
+		if lens[vhost] != value {
+			t.Errorf("group %s expected len %s, actual %s", vhost, value, lens[vhost])
+		}
+	}
+}
+
+func TestSenderWithoutGroupBy(t *testing.T) {
+	s, target := newTestSender(t, &Filter{})
+	s.sendStats(time.Now(), time.Second)
+
+	if len(target.messages) != 2 {
+		t.Fatalf("metrics without group_by must be sent even without rows, actual %d messages", len(target.messages))
+	}
+
+	if target.messages[0].Labels != nil {
+		t.Errorf("labels must be nil without group_by, actual %v", target.messages[0].Labels)
+	}
+}
+
+func TestSenderNumbers(t *testing.T) {
+	s, target := newTestSender(t, &Filter{})
+
+	s.appendIfOk(&RowEntry{
+		Fields:  map[string]string{"time": "5e-1"},
+		Numbers: map[string]float64{"time": 0.5},
+	})
+	s.sendStats(time.Now(), time.Second)
+
+	if target.messages[1].Metric != "max" || target.messages[1].Value != "0.500" {
+		t.Errorf("expected max 0.500, actual %+v", target.messages[1])
+	}
+}
+
+func TestSenderWhereOnly(t *testing.T) {
+	w, err := newWhere(`code >= 500`, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	filter := &Filter{Where: w, Items: []FilterItem{{"time", []string{"len"}}}}
+
+	config := &Config{
+		Period:     time.Second,
+		Aggregates: map[string]bool{"time": true},
+		Counts:     map[string]bool{},
+	}
+	target := new(fakeTarget)
+	s, err := NewSender(filter, config, []output.Target{target})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.resetData()
+
+	appendRows(s,
+		map[string]string{"code": "502", "time": "0.1"},
+		map[string]string{"code": "200", "time": "0.2"},
+		map[string]string{"code": "500", "time": "0.3"},
+	)
+	s.sendStats(time.Now(), time.Second)
+
+	if len(target.messages) != 1 || target.messages[0].Value != "2" {
+		t.Errorf("expected len 2 of rows matched by where, actual %+v", target.messages)
+	}
+}
+
+func TestSenderInvalidNumbers(t *testing.T) {
+	tests := []struct {
+		parser Parser
+		lines  []string
+	}{
+		{jsonParser{}, []string{`{"time": "-"}`, `{"time": ""}`, `{"time": true}`, `{"time": "0.001, 0.002"}`, `{"time": 0.5}`}},
+		{logfmtParser{}, []string{`time=- code=200`, `time= code=200`, `time code=200`, `time="0.001, 0.002"`, `time=0.5`}},
+		{ltsvParser{}, []string{"time:-\tcode:200", "time:\tcode:200", "time:true", "time:0.001, 0.002", "time:0.5"}},
+	}
+
+	for i, test := range tests {
+		s, target := newTestSender(t, &Filter{Prefix: fmt.Sprintf("invalid_numbers_test_%d", i)})
+
+		for _, raw := range test.lines {
+			row, err := test.parser.Parse(raw)
+			if err != nil {
+				t.Fatal(err)
+			}
+			s.appendIfOk(row)
+		}
+		s.sendStats(time.Now(), time.Second)
+
+		if target.messages[0].Metric != "len" || target.messages[0].Value != "1" {
+			t.Errorf("%T: expected len 1 of numbers only, actual %+v", test.parser, target.messages[0])
+		}
+		if v := s.invalidNumbers.Value(); v != 4 {
+			t.Errorf("%T: expected 4 invalid numbers, actual %d", test.parser, v)
+		}
+	}
+}
+
+func TestFileField(t *testing.T) {
+	w, err := newWhere(`file =~ "\\.access\\.log$"`, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	filter := &Filter{Where: w, GroupBy: []string{FileField}, Items: []FilterItem{{"time", []string{"len"}}}}
+
+	config := Config{
+		Period:     time.Second,
+		Parser:     jsonParser{},
+		Aggregates: map[string]bool{"time": true},
+		Counts:     map[string]bool{},
+	}
+	target := new(fakeTarget)
+	s, err := NewSender(filter, &config, []output.Target{target})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := &App{config: config, senderCollection: &SenderCollection{
+		procs:   []*Sender{s},
+		config:  &config,
+		metrics: newPipelineMetrics("file_field_test"),
+	}}
+	a.senderCollection.resetData()
+
+	lineChannel := make(chan input.Line, 4)
+	for _, line := range []input.Line{
+		{Text: `{"time": 0.1}`, Position: input.Position{File: "/var/log/a.access.log"}},
+		{Text: `{"time": 0.2}`, Position: input.Position{File: "/var/log/a.access.log"}},
+		{Text: `{"time": 0.3}`, Position: input.Position{File: "/var/log/b.access.log"}},
+		{Text: `{"time": 0.4}`, Position: input.Position{File: "/var/log/error.log"}},
+	} {
+		lineChannel <- line
+	}
+	close(lineChannel)
+	a.appendLine(lineChannel)
+	s.sendStats(time.Now(), time.Second)
+
+	expected := map[string]string{"/var/log/a.access.log": "2", "/var/log/b.access.log": "1"}
+	if len(target.messages) != len(expected) {
+		t.Fatalf("expected %d messages, actual %d", len(expected), len(target.messages))
+	}
+	for _, m := range target.messages {
+		if expected[m.Labels[FileField]] != m.Value {
+			t.Errorf("unexpected message %+v %+v", m, m.Labels)
+		}
+	}
+}
+
+//routingTargets are targets of "routing_test" outputs by "id" setting
+var routingTargets = map[string]*fakeTarget{}
+
+func init() {
+	output.RegisterOutput("routing_test", func(params map[string]string, templateVars map[string]string) (output.Target, error) {
+		target := new(fakeTarget)
+		routingTargets[params["id"]] = target
+		return target, nil
+	})
+}
+
+func TestFilterOutputs(t *testing.T) {
+	config := &Config{
+		Period: time.Second,
+		Counts: map[string]bool{"code": true},
+		Outputs: []*outputConfig{
+			{Type: "routing_test", Settings: map[string]string{"id": "console"}},
+			{Type: "routing_test", Name: "zabbix-prod", Settings: map[string]string{"id": "prod"}},
+			{Type: "routing_test", Settings: map[string]string{"id": "staging"}},
+		},
+	}
+	if err := processOutputs(config.Outputs); err != nil {
+		t.Fatal(err)
+	}
+	for _, prefix := range []string{"all_", "slo_", "debug_"} {
+		outputs := map[string][]string{
+			"slo_":   {"zabbix-prod", "routing_test#2"},
+			"debug_": {"routing_test"},
+		}[prefix]
+		config.Filters = append(config.Filters,
+			&Filter{Prefix: prefix, Outputs: outputs, Items: []FilterItem{{"code", []string{"cps_200"}}}})
+	}
+	if err := checkFilterOutputs(config.Filters, config.Outputs); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewSenderCollection(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.close()
+	s.sendStats(time.Now(), time.Second)
+
+	expected := map[string][]string{
+		"console": {"all_", "debug_"},
+		"prod":    {"all_", "slo_"},
+		"staging": {"all_", "slo_"},
+	}
+	for id, prefixes := range expected {
+		var actual []string
+		for _, m := range routingTargets[id].messages {
+			actual = append(actual, m.Prefix)
+		}
+		//senders send in parallel
+		sort.Strings(actual)
+		if fmt.Sprint(actual) != fmt.Sprint(prefixes) {
+			t.Errorf("output %s expected filters %v, actual %v", id, prefixes, actual)
+		}
+	}
+}
+
+//slowCheckpointer is an input which blocks the first Checkpoint until release is closed
+type slowCheckpointer struct {
+	entered chan struct{}
+	release chan struct{}
+	saved   []input.Position
+	m       sync.Mutex
+}
+
+func (c *slowCheckpointer) ReadToChannel(lineChannel chan<- input.Line) {}
+
+func (c *slowCheckpointer) Close() {}
+
+func (c *slowCheckpointer) Resume(stateFile string) error { return nil }
+
+func (c *slowCheckpointer) Checkpoint(positions []input.Position) error {
+	c.m.Lock()
+	first := c.entered != nil
+	if first {
+		close(c.entered)
+		c.entered = nil
+	}
+	c.m.Unlock()
+
+	if first {
+		<-c.release
+	}
+
+	c.m.Lock()
+	c.saved = append(c.saved, positions...)
+	c.m.Unlock()
+	return nil
+}
+
+func TestCheckpointOrder(t *testing.T) {
+	config := Config{Period: time.Second}
+	s, err := NewSenderCollection(&config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.close()
+
+	entered := make(chan struct{})
+	ir := &slowCheckpointer{entered: entered, release: make(chan struct{})}
+	a := &App{config: config, senderCollection: s, ir: ir}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	s.appendData(&RowEntry{}, input.Position{File: "access.log", Offset: 10})
+	go func() {
+		defer wg.Done()
+		a.sendPeriod(time.Now(), time.Second)
+	}()
+	<-entered
+
+	//positions of the next period must be saved after slow checkpoint of previous one
+	s.appendData(&RowEntry{}, input.Position{File: "access.log", Offset: 20})
+	go func() {
+		defer wg.Done()
+		a.sendPeriod(time.Now(), time.Second)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	close(ir.release)
+	wg.Wait()
+
+	if len(ir.saved) != 2 || ir.saved[0].Offset != 10 || ir.saved[1].Offset != 20 {
+		t.Errorf("positions must be saved in order of periods, actual %+v", ir.saved)
+	}
+}